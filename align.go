@@ -0,0 +1,132 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> align.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Reads the boundary and optional fill byte given to .align, e.g. "$100,$ea"
+func parseAlign(op string, inst instruction) instruction {
+	inst.kind = "dat"
+	inst.args = []string{"1", "0"}
+	if strings.TrimSpace(op) == "" {
+		errHandler(errs["align"], "Expected a boundary, e.g. .align $100.")
+		return inst
+	}
+	parts := strings.Split(op, ",")
+	if len(parts) > 2 {
+		errHandler(errs["align"], "Expected a boundary and an optional fill byte.")
+		return inst
+	}
+	for i, part := range parts {
+		n, e := evalExpr(part, 0)
+		switch {
+		case e != nil:
+			errHandler(errs["align"], e.Error())
+			return inst
+		case i == 0 && (n < 1 || n > 0x8000):
+			errHandler(errs["align"], "The boundary must be from 1 to $8000.")
+			return inst
+		case i == 1 && (n < 0 || n > 0xff):
+			errHandler(errs["align"], "The fill value must be a byte.")
+			return inst
+		}
+		inst.args[i] = strconv.Itoa(n)
+	}
+	return inst
+}
+
+// The number of bytes an .align at addr pads with
+func alignPadding(inst instruction, addr int) int {
+	n, _ := strconv.Atoi(inst.args[0])
+	return (n - addr%n) % n
+}
+
+// The padding an .align at addr emits. Segments that only reserve space get no bytes.
+func alignBytes(inst instruction, addr int, bss bool) []byte {
+	if bss {
+		return nil
+	}
+	fill, _ := strconv.Atoi(inst.args[1])
+	pad := make([]byte, alignPadding(inst, addr))
+	for i := range pad {
+		pad[i] = byte(fill)
+	}
+	return pad
+}
+
+// Checks that the object code between each .page and .endpage stays within one 256-byte page.
+// Only lines in the same segment as the .page count.
+func checkPages(insts []instruction, obj [][]byte) {
+	segs := lineSegments(insts)
+	open := -1
+	first, last := -1, -1
+	for i, inst := range insts {
+		curLine = i
+		switch {
+		case inst.mnemonic == ".page":
+			if open >= 0 {
+				errHandler(errs["page"], ".page blocks can't be nested; the last one starts on line "+strconv.Itoa(sourceLine(open)+1)+".")
+			}
+			open, first, last = i, -1, -1
+		case inst.mnemonic == ".endpage":
+			if open < 0 {
+				errHandler(errs["page"], ".endpage without .page.")
+				continue
+			}
+			if first >= 0 && first>>8 != last>>8 {
+				curLine = open
+				errHandler(errs["page"], fmt.Sprintf("Lines %d-%d run from $%04X to $%04X, crossing into page $%02X.", sourceLine(open)+1, sourceLine(i)+1, first, last, last>>8))
+			}
+			open = -1
+		case open >= 0 && segs[i] == segs[open]:
+			addr := runAddr(i)
+			end := addr + len(obj[i]) - 1
+			if inst.mnemonic == ".align" {
+				end = addr + alignPadding(inst, addr) - 1
+			}
+			if end >= addr {
+				if first < 0 {
+					first = addr
+				}
+				last = end
+			}
+		}
+	}
+	if open >= 0 {
+		curLine = open
+		errHandler(errs["page"], ".page without .endpage.")
+	}
+}
@@ -0,0 +1,52 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> align_test.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import "testing"
+
+func TestAlignWithoutBoundary(t *testing.T) {
+	testAssemble(t, "        org $0800\n        nop\n        .align\n        nop\n")
+	if !hasDiagnostic(errs["align"][2]) {
+		t.Errorf("a bare .align should report %s, got %v", errs["align"][2], diagnostics)
+	}
+}
+
+func TestAlignToNonPowerOfTwo(t *testing.T) {
+	_, obj := testAssemble(t, "        org $0800\n        nop\n        .align 6,$ea\n        nop\n")
+	if len(diagnostics) > 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	expectBytes(t, flatBytes(obj), "ea ea ea ea ea")
+	if addr := lineAddrs[len(lineAddrs)-2]; addr != 0x0804 {
+		t.Errorf("last nop is at $%04X, want $0804", addr)
+	}
+}
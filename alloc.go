@@ -0,0 +1,252 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> alloc.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Zero page allocation with .zp, from the range set by .zparea
+var zpStart, zpEnd int = 0x00, 0xff
+var zpNext int
+
+// The open .struct or .enum block, -1 if none
+var structStart, enumStart int = -1, -1
+var structName string
+var structSize int
+var structNames = map[string]bool{} // every struct, for sizeof
+var enumNext int
+
+// Clears the allocator and blocks at the start of each pass
+func resetBlocks() {
+	zpStart, zpEnd, zpNext = 0x00, 0xff, 0x00
+	structStart, enumStart = -1, -1
+	structName = ""
+}
+
+// Adds a symbol with a fixed value in pass 1, as equ does
+func defineConstant(label string, value int) {
+	if pass != 1 {
+		return
+	}
+	var tmp symbol
+	tmp.label = curScope + label
+	tmp.defLine = curLine
+	tmp.kind = "equ"
+	if symbolExists(tmp.label) {
+		errHandler(errs["duplicatesym"])
+	} else if _, ok := varLines[tmp.label]; ok {
+		errHandler(errs["duplicatesym"], tmp.label+" is a variable.")
+	}
+	symbols = append(symbols, withValue(tmp, value))
+}
+
+// Constants whose value uses the size of a .proc or .scope, by name
+var sizedEquates = map[string]bool{}
+
+// Defines a constant from an expression. One that uses the size of a .proc or .scope is worked out
+// again every pass, since the size is only known once a pass has placed the block.
+func defineEquate(label string, expr []token) {
+	name := curScope + label
+	val, sized, e := evalEquate(expr)
+	if e != nil {
+		errHandler(errs["expression"], e.Error())
+	}
+	if pass == 1 {
+		defineConstant(label, val)
+		sizedEquates[name] = sized
+	} else if n := symbolIndex(name); n >= 0 && sizedEquates[name] {
+		symbols[n] = withValue(symbols[n], val)
+	}
+}
+
+// Sets a symbol's value along with the bytes kept for it
+func withValue(sym symbol, value int) symbol {
+	sym.intAddr = value
+	bytes := intToHex(value & 0xffff)
+	sym.addHighByte = 0
+	if len(bytes) > 1 {
+		sym.addHighByte = bytes[0]
+	}
+	sym.addLowByte = bytes[len(bytes)-1]
+	return sym
+}
+
+// Sets the range .zp allocates from, e.g. ".zparea $80,$ff"
+func parseZpArea(op string, inst instruction) instruction {
+	parts := strings.Split(op, ",")
+	if len(parts) != 2 {
+		errHandler(errs["alloc"], "Expected the first and last address, e.g. .zparea $80,$ff.")
+		return inst
+	}
+	start, e1 := evalExpr(parts[0], 0)
+	end, e2 := evalExpr(parts[1], 0)
+	if e1 != nil || e2 != nil || start < 0 || end > 0xff || start > end {
+		errHandler(errs["alloc"], "The area must be within $00-$FF and end after it starts.")
+		return inst
+	}
+	zpStart, zpEnd, zpNext = start, end, start
+	return inst
+}
+
+// Allocates a variable in zero page, e.g. ".zp ptr,2"
+func parseZp(op string, inst instruction) instruction {
+	parts := strings.Split(op, ",")
+	size := 1
+	if len(parts) > 2 || !rLabel.MatchString(parts[0]) {
+		errHandler(errs["alloc"], "Expected a name and an optional size, e.g. .zp ptr,2.")
+		return inst
+	}
+	if len(parts) == 2 {
+		var e error
+		if size, e = evalExpr(parts[1], 0); e != nil || size < 1 {
+			errHandler(errs["alloc"], "The size must be a positive number.")
+			return inst
+		}
+	}
+	if zpNext+size-1 > zpEnd {
+		errHandler(errs["alloc"], fmt.Sprintf("%s needs %d bytes but only %d are left in $%02X-$%02X.", parts[0], size, zpEnd-zpNext+1, zpStart, zpEnd))
+		return inst
+	}
+	inst.args = []string{parts[0]}
+	defineConstant(parts[0], zpNext)
+	zpNext += size
+	return inst
+}
+
+// Reserves bytes at the program counter, or adds a field when inside a .struct. Reserved bytes are
+// zeros, except in segments that only reserve space.
+func parseRes(op string, inst instruction) instruction {
+	size, e := evalExpr(op, 0)
+	if e != nil || size < 0 {
+		errHandler(errs["alloc"], "Expected the number of bytes to reserve.")
+		return inst
+	}
+	if structStart >= 0 {
+		if inst.label != "" {
+			defineConstant(inst.label, structSize)
+		}
+		structSize += size
+		return inst
+	}
+	inst.kind = "dat"
+	inst.length = size
+	inst.data = make([]byte, size)
+	return inst
+}
+
+// Opens and closes .struct and .enum blocks. A struct's fields get their offsets and its name gets
+// its size; enum members count up from the given start.
+func parseBlock(cur instruction) instruction {
+	switch cur.mnemonic {
+	case ".struct":
+		name := cur.label
+		if len(cur.args) > 0 {
+			name = cur.args[0]
+		}
+		if structStart >= 0 || enumStart >= 0 {
+			errHandler(errs["block"], "Blocks can't be nested.")
+		} else if !rLabel.MatchString(name) {
+			errHandler(errs["block"], "Expected a name for the struct.")
+		} else {
+			structStart, structName, structSize = curLine, name, 0
+		}
+		cur.label = ""
+	case ".endstruct":
+		if structStart < 0 {
+			errHandler(errs["block"], ".endstruct without .struct.")
+		} else {
+			defineConstant(structName, structSize)
+			structNames[curScope+structName] = true
+			structStart = -1
+		}
+	case ".enum":
+		if structStart >= 0 || enumStart >= 0 {
+			errHandler(errs["block"], "Blocks can't be nested.")
+			break
+		}
+		enumStart, enumNext = curLine, 0
+		if len(cur.args) > 0 {
+			n, e := evalExpr(cur.args[0], 0)
+			if e != nil {
+				errHandler(errs["block"], "Expected the value of the first member.")
+			}
+			enumNext = n
+		}
+	case ".endenum":
+		if enumStart < 0 {
+			errHandler(errs["block"], ".endenum without .enum.")
+		}
+		enumStart = -1
+	case "", ".res":
+	default:
+		if structStart >= 0 {
+			errHandler(errs["block"], "Only .res fields can go in a .struct.")
+		}
+	}
+	return cur
+}
+
+// Gives a name on its own line inside an .enum the next number
+func enumMember(name string) {
+	defineConstant(name, enumNext)
+	enumNext++
+}
+
+// Checks that every .struct and .enum was closed
+func checkBlocks() {
+	for _, start := range []int{structStart, enumStart} {
+		if start >= 0 {
+			curLine = start
+			errHandler(errs["block"], "Block is missing its end.")
+		}
+	}
+}
+
+// The space a line takes in a segment that only reserves space
+func reservedLength(inst instruction, addr int) int {
+	switch inst.mnemonic {
+	case ".res":
+		return inst.length
+	case ".align":
+		return alignPadding(inst, addr)
+	}
+	return 0
+}
+
+// Whether a label operand can use zero page addressing. Labels in relocatable code and imported
+// symbols could end up anywhere, so they are always absolute.
+func isZpSymbol(label string) bool {
+	sym, ok := lookupSymbol(label)
+	return ok && sym.intAddr <= 0xff && sym.kind != "imp" && (sym.kind != "lbl" || !relocatable)
+}
@@ -0,0 +1,93 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> alloc_test.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import "testing"
+
+// The values of the symbols the last assembly defined
+func symbolValues() map[string]int {
+	values := map[string]int{}
+	for _, sym := range symbols {
+		values[sym.label] = sym.intAddr
+	}
+	return values
+}
+
+func TestAllocation(t *testing.T) {
+	_, obj := testAssemble(t, `        org $0800
+        .zparea $80,$ff
+        .zp ptr,2
+        .zp count
+actor   .struct
+xpos    .res 1
+ypos    .res 1
+        .endstruct
+        .enum 1
+red
+green
+        .endenum
+        lda (ptr),y
+        sta count
+        lda player+ypos
+        rts
+player: .res actor
+`)
+	if len(diagnostics) > 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	want := map[string]int{"ptr": 0x80, "count": 0x82, "actor": 2, "xpos": 0, "ypos": 1, "red": 1, "green": 2, "player": 0x0808}
+	values := symbolValues()
+	for name, val := range want {
+		if values[name] != val {
+			t.Errorf("%s = $%04X, want $%04X", name, values[name], val)
+		}
+	}
+	expectBytes(t, flatBytes(obj), "b1 80 85 82 ad 09 08 60 00 00")
+}
+
+func TestAllocationErrors(t *testing.T) {
+	for _, test := range []struct{ src, err string }{
+		{"        .zparea $fe,$ff\n        .zp ptr,2\n        .zp more\n", "alloc"},
+		{"        .zparea $80,$100\n", "alloc"},
+		{"        .zp ptr,0\n", "alloc"},
+		{"        .res -1\n", "alloc"},
+		{"actor   .struct\n        nop\n        .endstruct\n", "block"},
+		{"actor   .struct\n        .enum\n", "block"},
+		{"        .enum\nred\n", "block"},
+		{"        .endstruct\n", "block"},
+	} {
+		testAssemble(t, test.src)
+		if !hasDiagnostic(errs[test.err][2]) {
+			t.Errorf("%q: got %v, want %s", test.src, diagnostics, errs[test.err][2])
+		}
+	}
+}
@@ -0,0 +1,127 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> banks.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Bank switching. Regions declared with bank=n in the memory map can share CPU addresses with
+// regions in other banks, e.g. several 8K banks mapped into the same window at $8000. Each banked
+// region is written to its own part of the output image, padded to its full size, in bank order
+// and ahead of everything that isn't banked.
+
+// The bank a segment's region is in, -1 if it isn't banked
+func segmentBank(name string) int {
+	n := findSegment(memMap, name)
+	if n < 0 {
+		return -1
+	}
+	if r := findRegion(memMap, memMap.segments[n].region); r >= 0 {
+		return memMap.regions[r].bank
+	}
+	return -1
+}
+
+// The bank a label is in, -1 for constants and labels that aren't banked
+func symbolBank(sym symbol) int {
+	if sym.kind != "lbl" {
+		return -1
+	}
+	return segmentBank(sym.segment)
+}
+
+// Warns about each jsr straight into another bank. Whatever is switched into the window at the
+// time would run instead.
+func checkBanks(insts []instruction) {
+	segs := lineSegments(insts)
+	for i, inst := range insts {
+		if inst.mnemonic != "jsr" || inst.symRef == "" {
+			continue
+		}
+		sym, ok := lookupSymbol(inst.symRef)
+		if !ok {
+			continue
+		}
+		from, to := segmentBank(segs[i]), symbolBank(sym)
+		if from >= 0 && to >= 0 && from != to {
+			curLine = i
+			warnHandler(errs["bank"], fmt.Sprintf("%s is in bank %d but is called from bank %d. Switch banks first, or call it through code outside the banks.", sym.label, to, from))
+		}
+	}
+}
+
+// The banked regions of a memory map in the order they go in the output image
+func bankedRegions(mm memoryMap) (banks []int) {
+	for i, r := range mm.regions {
+		if r.bank >= 0 {
+			banks = append(banks, i)
+		}
+	}
+	sort.SliceStable(banks, func(a, b int) bool { return mm.regions[banks[a]].bank < mm.regions[banks[b]].bank })
+	return
+}
+
+// Lays the banked regions out one after another, each padded to its full size with its fill
+// value or zero
+func bankImage(mm memoryMap, objs []objectFile, bases [][]int) (image []byte) {
+	for _, n := range bankedRegions(mm) {
+		r := mm.regions[n]
+		part := make([]byte, r.size)
+		if r.fill >= 0 {
+			for a := range part {
+				part[a] = byte(r.fill)
+			}
+		}
+		for i, o := range objs {
+			for j, seg := range o.segments {
+				if !seg.bss && findRegion(mm, mm.segments[findSegment(mm, seg.name)].region) == n {
+					copy(part[bases[i][j]-r.start:], seg.data)
+				}
+			}
+		}
+		image = append(image, part...)
+	}
+	return
+}
+
+// Describes where each bank went in the output image
+func bankSummary(mm memoryMap) (out string) {
+	var offset int
+	for _, n := range bankedRegions(mm) {
+		r := mm.regions[n]
+		out += setStringToWidth(r.name, 10) + fmt.Sprintf("bank %-3d $%04X  $%04X  at $%05X in the image\n", r.bank, r.start, r.start+r.size-1, offset)
+		offset += r.size
+	}
+	return
+}
@@ -0,0 +1,57 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> banks_test.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import "testing"
+
+func TestFillSummaryPerBank(t *testing.T) {
+	useMemoryMap(t, `region FIXED start=$c000 size=$0010
+region B0 start=$8000 size=$0008 bank=0
+region B1 start=$8000 size=$0008 bank=1
+segment CODE region=FIXED
+segment BANK0 region=B0
+segment BANK1 region=B1
+`)
+	insts, obj := testAssemble(t, `        jmp ina
+        .segment "BANK0"
+ina:    nop
+        rts
+        .segment "BANK1"
+        rts
+`)
+	want := `Object will fill from $C000 through $C002. ($0003 bytes)
+Bank 0 will fill from $8000 through $8001. ($0002 bytes)
+Bank 1 will fill from $8000 through $8000. ($0001 bytes)`
+	if got := fillSummary(insts, obj); got != want {
+		t.Errorf("got summary\n%s\nwant\n%s", got, want)
+	}
+}
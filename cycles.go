@@ -0,0 +1,171 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> cycles.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Opcodes that take an extra cycle when indexing crosses into the next page
+var opPageCross = map[byte]bool{
+	0x11: true, 0x19: true, 0x1d: true, // ora
+	0x31: true, 0x39: true, 0x3d: true, // and
+	0x51: true, 0x59: true, 0x5d: true, // eor
+	0x71: true, 0x79: true, 0x7d: true, // adc
+	0xb1: true, 0xb9: true, 0xbd: true, // lda
+	0xbc: true, 0xbe: true, // ldy, ldx
+	0xd1: true, 0xd9: true, 0xdd: true, // cmp
+	0xf1: true, 0xf9: true, 0xfd: true} // sbc
+
+// A .cycles block, summed when its .endcycles is reached
+type cycleBlock struct {
+	start  int // line of the .cycles directive
+	target int // expected count, -1 if none
+	min    int
+	max    int
+}
+
+var cycleTotals = map[int]cycleBlock{} // finished blocks by the line of their .endcycles
+
+// Works out the fewest and most cycles an assembled instruction at addr can take. Branches take one
+// more cycle when taken and another when the target is on a different page; indexed reads may take
+// one more when the index carries into the next page.
+func instCycles(inst instruction, addr int) (min, max int) {
+	if inst.isComment || inst.kind == "dat" || inst.mnemonic == "" {
+		return 0, 0
+	}
+	target := hexToInt([2]byte{inst.opHighByte, inst.opLowByte})
+	switch inst.kind {
+	case "rel":
+		max = 3
+		if (addr+2)>>8 != target>>8 {
+			max = 4
+		}
+		return 2, max
+	case "far": // the inverted branch skips the jmp when the original branch isn't taken
+		min = 3
+		if (addr+2)>>8 != (addr+5)>>8 {
+			min = 4
+		}
+		return min, 5
+	}
+	min = opCycles[inst.opcode]
+	max = min
+	if opPageCross[inst.opcode] && !(inst.kind != "zpiy" && inst.opLowByte == 0) { // $xx00,x can't cross
+		max++
+	}
+	return min, max
+}
+
+// Formats an instruction's cycles for the listing: "4" when fixed, "4+" when a page crossing may
+// add one, "2/3" for a branch not taken/taken.
+func cycleText(inst instruction, addr int) string {
+	min, max := instCycles(inst, addr)
+	switch {
+	case max == 0:
+		return ""
+	case inst.kind == "rel" || inst.kind == "far":
+		return strconv.Itoa(min) + "/" + strconv.Itoa(max)
+	case max > min:
+		return strconv.Itoa(min) + "+"
+	}
+	return strconv.Itoa(min)
+}
+
+// Reads the expected count given to .cycles, which may be any expression
+func parseCycleTarget(op string) []string {
+	if op == "" {
+		return nil
+	}
+	n, e := evalExpr(op, 0)
+	if e != nil || n < 0 {
+		errHandler(errs["cycles"], "Expected a cycle count, not "+op+".")
+		return nil
+	}
+	return []string{strconv.Itoa(n)}
+}
+
+// Sums the instructions between each .cycles and its .endcycles. Blocks may be nested. A block with
+// a target must take exactly that many cycles; one that only might (depending on branches and page
+// crossings) gets a warning.
+func checkCycles(insts []instruction) {
+	var open []cycleBlock
+	cycleTotals = map[int]cycleBlock{}
+	for i, inst := range insts {
+		curLine = i
+		switch inst.mnemonic {
+		case ".cycles":
+			block := cycleBlock{start: i, target: -1}
+			if len(inst.args) > 0 {
+				block.target, _ = strconv.Atoi(inst.args[0])
+			}
+			open = append(open, block)
+		case ".endcycles":
+			if len(open) == 0 {
+				errHandler(errs["cycles"], ".endcycles without .cycles.")
+				continue
+			}
+			block := open[len(open)-1]
+			open = open[:len(open)-1]
+			cycleTotals[i] = block
+			if len(open) > 0 { // the outer block includes this one
+				open[len(open)-1].min += block.min
+				open[len(open)-1].max += block.max
+			}
+			switch {
+			case block.target < 0:
+			case block.target < block.min || block.target > block.max:
+				errHandler(errs["cycles"], fmt.Sprintf("Block from line %d takes %s cycles, not %d.", sourceLine(block.start)+1, cycleRange(block), block.target))
+			case block.min != block.max:
+				warnHandler(errs["cycles"], fmt.Sprintf("Block from line %d takes %s cycles depending on branches and page crossings.", sourceLine(block.start)+1, cycleRange(block)))
+			}
+		default:
+			if len(open) > 0 {
+				min, max := instCycles(inst, runAddr(i))
+				open[len(open)-1].min += min
+				open[len(open)-1].max += max
+			}
+		}
+	}
+	for _, block := range open {
+		curLine = block.start
+		errHandler(errs["cycles"], ".cycles without .endcycles.")
+	}
+}
+
+func cycleRange(block cycleBlock) string {
+	if block.min == block.max {
+		return strconv.Itoa(block.min)
+	}
+	return strconv.Itoa(block.min) + "-" + strconv.Itoa(block.max)
+}
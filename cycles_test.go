@@ -0,0 +1,117 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> cycles_test.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCycleTargetExpression(t *testing.T) {
+	testAssemble(t, `        org $0800
+loops   equ $02
+        .cycles 2*loops
+        nop
+        nop
+        .endcycles
+`)
+	if hasDiagnostic(errs["cycles"][2]) {
+		t.Errorf("block of 2*loops cycles reported: %v", diagnostics)
+	}
+	testAssemble(t, `        org $0800
+        .cycles $02+1
+        nop
+        .endcycles
+`)
+	if !hasDiagnostic(errs["cycles"][2]) {
+		t.Error("block of 2 cycles passed a target of $02+1")
+	}
+	testAssemble(t, `        org $0800
+        .cycles 2*
+        nop
+        .endcycles
+`)
+	if !hasDiagnostic(errs["cycles"][2]) {
+		t.Error("malformed cycle target accepted")
+	}
+}
+
+func TestInstructionCycles(t *testing.T) {
+	insts, _ := testAssemble(t, `        org $08f8
+        beq far
+        .res 7
+far:    lda #$00
+        lda $1234,x
+        lda $1200,x
+        lda ($10),y
+        sta $1234,x
+        jmp near
+near:   bne near
+`)
+	if len(diagnostics) > 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	want := []string{"", "2/4", "", "2", "4+", "4", "5+", "5", "3", "2/3", ""}
+	for i, inst := range insts {
+		if got := cycleText(inst, lineAddrs[i]); got != want[i] {
+			t.Errorf("line %d: got %q cycles, want %q", i+1, got, want[i])
+		}
+	}
+}
+
+// Nested blocks add up into the block around them. A block with a target that depends on a branch
+// is warned about; one without a target isn't.
+func TestCycleBlocks(t *testing.T) {
+	testAssemble(t, `        org $0800
+        .cycles
+        ldx #$04
+        .cycles 7
+loop:   nop
+        dex
+        bne loop
+        .endcycles
+        .endcycles
+`)
+	if len(diagnostics) != 1 || diagnostics[0].severity != 2 || !strings.Contains(diagnostics[0].message, "Block from line 4 takes 6-7 cycles") {
+		t.Fatalf("got diagnostics %v, want a warning about the block from line 4", diagnostics)
+	}
+	if inner := cycleTotals[7]; inner.min != 6 || inner.max != 7 {
+		t.Errorf("inner block takes %s cycles, want 6-7", cycleRange(inner))
+	}
+	if outer := cycleTotals[8]; outer.min != 8 || outer.max != 9 || outer.target != -1 {
+		t.Errorf("outer block takes %s cycles, want 8-9", cycleRange(outer))
+	}
+	testAssemble(t, "        nop\n        .endcycles\n        .cycles\n")
+	if len(diagnostics) != 2 {
+		t.Errorf("got diagnostics %v, want unmatched .endcycles and .cycles", diagnostics)
+	}
+}
@@ -0,0 +1,104 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> directives.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Directives whose operands are lists of expressions and quoted strings
+var textDirectives = map[string]bool{".assert": true, ".error": true, ".print": true, ".warning": true}
+
+// Runs the text directives once every address is final, each seeing the variables of its own line
+func checkDirectives(insts []instruction) {
+	final := asmVars
+	defer func() { asmVars = final }()
+	for i, inst := range insts {
+		if !textDirectives[inst.mnemonic] {
+			continue
+		}
+		curLine = i
+		curScope = lineScopes[i]
+		asmVars = lineVars[i]
+		switch inst.mnemonic {
+		case ".assert":
+			if len(inst.args) == 0 {
+				errHandler(errs["expression"], ".assert needs an expression.")
+				continue
+			}
+			val, e := evalExpr(inst.args[0], runAddr(i))
+			if e != nil {
+				errHandler(errs["expression"], e.Error())
+			} else if val == 0 {
+				msg := inst.args[0] + " is false."
+				if len(inst.args) > 1 {
+					msg, _ = directiveText(inst.args[1:])
+				}
+				errHandler(errs["assert"], msg)
+			}
+		case ".error":
+			if msg, ok := directiveText(inst.args); ok {
+				errHandler(errs["usererror"], msg)
+			}
+		case ".warning":
+			if msg, ok := directiveText(inst.args); ok {
+				warnHandler(errs["userwarning"], msg)
+			}
+		case ".print":
+			if msg, ok := directiveText(inst.args); ok && !collectDiagnostics {
+				fmt.Printf("[line %d] %s\n", sourceLine(i)+1, msg)
+			}
+		}
+	}
+}
+
+// Joins directive arguments into a message: strings as written, expressions as their value in
+// decimal and hex with a space between consecutive values
+func directiveText(args []string) (msg string, ok bool) {
+	for i, arg := range args {
+		if len(arg) >= 2 && strings.HasPrefix(arg, `"`) && strings.HasSuffix(arg, `"`) {
+			msg += arg[1 : len(arg)-1]
+			continue
+		}
+		if i > 0 && !strings.HasPrefix(args[i-1], `"`) {
+			msg += " "
+		}
+		val, e := evalExpr(arg, runAddr(curLine))
+		if e != nil {
+			errHandler(errs["expression"], e.Error())
+			return "", false
+		}
+		msg += fmt.Sprintf("%d ($%04X)", val, val)
+	}
+	return msg, true
+}
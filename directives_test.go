@@ -0,0 +1,98 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> directives_test.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Assertions are checked once the addresses are final, so they can use labels defined later
+func TestAssert(t *testing.T) {
+	for _, test := range []struct{ line, err, details string }{
+		{"        .assert end-start == 3", "", ""},
+		{"        .assert * == $0803", "", ""},
+		{"        .assert end-start > 3", "assert", "end-start > 3 is false."},
+		{`        .assert end < $0800, "end is at ", end`, "assert", "end is at 2051 ($0803)"},
+		{"        .assert nowhere", "expression", "Unknown symbol nowhere in expression."},
+	} {
+		testAssemble(t, "        org $0800\nstart:  lda $1234\n"+test.line+"\nend:    rts\n")
+		if test.err == "" {
+			if len(diagnostics) > 0 {
+				t.Errorf("%s: unexpected diagnostics %v", test.line, diagnostics)
+			}
+			continue
+		}
+		want := diagnostic{2, 1, errs[test.err][0], errs[test.err][2], errs[test.err][1] + " " + test.details}
+		if len(diagnostics) != 1 || diagnostics[0] != want {
+			t.Errorf("%s: got %v, want %v", test.line, diagnostics, want)
+		}
+	}
+}
+
+func TestErrorAndWarning(t *testing.T) {
+	testAssemble(t, `size    equ $03
+        .warning "size is ", size, " bytes"
+        .error "too big by ", size-1
+`)
+	if len(diagnostics) != 2 {
+		t.Fatalf("got diagnostics %v, want a warning and an error", diagnostics)
+	}
+	if d := diagnostics[0]; d.severity != 2 || d.code != errs["userwarning"][2] || d.message != errs["userwarning"][1]+" size is 3 ($0003) bytes" {
+		t.Errorf("got warning %+v", d)
+	}
+	if d := diagnostics[1]; d.severity != 1 || d.code != errs["usererror"][2] || d.message != errs["usererror"][1]+" too big by 2 ($0002)" {
+		t.Errorf("got error %+v", d)
+	}
+}
+
+func TestPrint(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.txt")
+	file, err := os.Create(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = file
+	assemble(splitSource(`        org $0800
+        .print "start ", *, " end ", end
+end:    rts
+`))
+	os.Stdout = stdout
+	file.Close()
+	got, _ := ioutil.ReadFile(out)
+	if want := "[line 2] start 2048 ($0800) end 2048 ($0800)\n"; string(got) != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,222 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> encoding.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Character encodings for string and character literals. Each converts one character and reports
+// whether the encoding has it.
+var encodings = map[string]func(c rune) (byte, bool){
+	"ascii":   asciiByte,
+	"apple":   appleByte,
+	"petscii": petsciiByte,
+	"screen":  screenByte,
+	"atascii": atasciiByte}
+
+var encoding string = "ascii" // selected with .encoding
+var charmap = map[rune]byte{} // overrides set with .charmap, cleared by .encoding
+
+// Goes back to plain ASCII at the start of each pass
+func resetEncoding() {
+	encoding = "ascii"
+	charmap = map[rune]byte{}
+}
+
+// ASCII, with \n as line feed
+func asciiByte(c rune) (byte, bool) {
+	return byte(c), c < 0x80
+}
+
+// Apple II text: ASCII with the high bit set, and \n as return
+func appleByte(c rune) (byte, bool) {
+	if c == '\n' {
+		return 0x8d, true
+	}
+	return byte(c) | 0x80, c < 0x80
+}
+
+// Commodore PETSCII. Lowercase letters give the codes shown as capitals after power-on; capitals
+// give the shifted codes, shown as capitals in lowercase mode.
+func petsciiByte(c rune) (byte, bool) {
+	switch {
+	case c == '\n':
+		return 0x0d, true
+	case c >= 'a' && c <= 'z':
+		return byte(c - 'a' + 0x41), true
+	case c >= 'A' && c <= 'Z':
+		return byte(c - 'A' + 0xc1), true
+	case c >= ' ' && c <= ']' || c == '^' || c == '_': // ^ and _ are the up and left arrows
+		return byte(c), true
+	}
+	return 0, false
+}
+
+// Commodore 64 screen codes, with letters arranged as in petsciiByte
+func screenByte(c rune) (byte, bool) {
+	switch {
+	case c == '@':
+		return 0x00, true
+	case c >= 'a' && c <= 'z':
+		return byte(c - 'a' + 0x01), true
+	case c >= 'A' && c <= 'Z':
+		return byte(c - 'A' + 0x41), true
+	case c >= ' ' && c <= '?':
+		return byte(c), true
+	case c == '[' || c == ']' || c == '^' || c == '_':
+		return byte(c - 0x40), true
+	}
+	return 0, false
+}
+
+// Atari ATASCII: printable ASCII except the characters replaced by graphics, and \n as end of line
+func atasciiByte(c rune) (byte, bool) {
+	switch {
+	case c == '\n':
+		return 0x9b, true
+	case c >= ' ' && c <= 'z' && c != '`' || c == '|':
+		return byte(c), true
+	}
+	return 0, false
+}
+
+// Selects the encoding for the literals that follow, e.g. ".encoding petscii"
+func parseEncoding(op string, inst instruction) instruction {
+	name := strings.ToLower(strings.Trim(op, `"`))
+	if _, ok := encodings[name]; !ok {
+		errHandler(errs["encoding"], "Unknown encoding "+name+". Use ascii, apple, petscii, screen or atascii.")
+		return inst
+	}
+	encoding = name
+	charmap = map[rune]byte{}
+	return inst
+}
+
+// Overrides the code of one character, given as a literal or its ASCII code, e.g. ".charmap '@',$00"
+func parseCharmap(op string, inst instruction) instruction {
+	args := splitArgs(op)
+	if len(args) != 2 {
+		errHandler(errs["encoding"], "Expected a character and its code, e.g. .charmap '@',$00.")
+		return inst
+	}
+	var c rune
+	if isTextLiteral(args[0]) {
+		chars, e := unquote(args[0])
+		if e != nil || len(chars) != 1 {
+			errHandler(errs["encoding"], "Expected a single character.")
+			return inst
+		}
+		c = chars[0]
+	} else if n, e := evalExpr(args[0], 0); e == nil && n >= 0 && n < 0x80 {
+		c = rune(n)
+	} else {
+		errHandler(errs["encoding"], "Expected a character or an ASCII code below $80.")
+		return inst
+	}
+	code, e := evalExpr(args[1], 0)
+	if e != nil || code < 0 || code > 0xff {
+		errHandler(errs["encoding"], "The code must be a byte.")
+		return inst
+	}
+	charmap[c] = byte(code)
+	return inst
+}
+
+// Whether an operand is a quoted string or character
+func isTextLiteral(s string) bool {
+	return len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0]
+}
+
+// Reads the characters of a quoted literal. \n, \\, \" and \' are escapes.
+func unquote(lit string) (chars []rune, e error) {
+	body := []rune(lit[1 : len(lit)-1])
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c == '\\' {
+			if i++; i == len(body) {
+				return nil, errors.New("Literal ends with a lone \\.")
+			}
+			switch body[i] {
+			case 'n':
+				c = '\n'
+			case '\\', '"', '\'':
+				c = body[i]
+			default:
+				return nil, fmt.Errorf("Unknown escape \\%c.", body[i])
+			}
+		}
+		chars = append(chars, c)
+	}
+	return chars, nil
+}
+
+// Converts a quoted literal to bytes in the current encoding
+func encodeText(lit string) ([]byte, error) {
+	chars, e := unquote(lit)
+	if e != nil {
+		return nil, e
+	}
+	var out []byte
+	for _, c := range chars {
+		b, ok := charmap[c]
+		if !ok {
+			b, ok = encodings[encoding](c)
+		}
+		if !ok {
+			return nil, fmt.Errorf("%q has no code in %s.", c, encoding)
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+// Returns the index just past the quote that closes the one at line[i], or the end of the line
+func quoteEnd(line string, i int) int {
+	end, _ := quoteClose(line, i)
+	return end
+}
+
+// Finds the quote closing the one at line[i], skipping escaped characters. ok is false if there
+// isn't one.
+func quoteClose(line string, i int) (end int, ok bool) {
+	for j := i + 1; j < len(line); j++ {
+		if line[j] == '\\' {
+			j++
+		} else if line[j] == line[i] {
+			return j + 1, true
+		}
+	}
+	return len(line), false
+}
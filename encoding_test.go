@@ -0,0 +1,102 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> encoding_test.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEncodings(t *testing.T) {
+	defer resetEncoding()
+	for _, test := range []struct{ encoding, lit, want string }{
+		{"ascii", `"Hi @\n"`, "48 69 20 40 0a"},
+		{"apple", `"Hi @\n"`, "c8 e9 a0 c0 8d"},
+		{"petscii", `"Hi @\n"`, "c8 49 20 40 0d"},
+		{"petscii", `"[^_]"`, "5b 5e 5f 5d"},
+		{"screen", `"Hi @1?"`, "48 09 20 00 31 3f"},
+		{"screen", `"[^_]"`, "1b 1e 1f 1d"},
+		{"atascii", `"Hi |\n"`, "48 69 20 7c 9b"},
+		{"ascii", `'\''`, "27"},
+		{"ascii", `"a\\b\"c"`, "61 5c 62 22 63"},
+	} {
+		resetEncoding()
+		encoding = test.encoding
+		got, err := encodeText(test.lit)
+		if err != nil || fmt.Sprintf("% x", got) != test.want {
+			t.Errorf("%s %s: got % x (%v), want %s", test.encoding, test.lit, got, err, test.want)
+		}
+	}
+}
+
+// Characters an encoding has no code for, and malformed escapes, are errors
+func TestEncodingMissing(t *testing.T) {
+	defer resetEncoding()
+	for _, test := range []struct{ encoding, lit string }{
+		{"ascii", `"é"`},
+		{"petscii", `"{"`},
+		{"screen", `"\n"`},
+		{"atascii", "\"`\""},
+		{"ascii", `"\t"`},
+		{"ascii", `"ends\"`},
+	} {
+		resetEncoding()
+		encoding = test.encoding
+		if got, err := encodeText(test.lit); err == nil {
+			t.Errorf("%s %s: got % x, want an error", test.encoding, test.lit, got)
+		}
+	}
+}
+
+// .encoding applies to the lines after it, and .charmap lasts until the next .encoding
+func TestEncodingDirectives(t *testing.T) {
+	_, obj := testAssemble(t, `        dfb "A"
+        .encoding screen
+        dfb "a@"
+        .charmap '@',$60
+        .charmap $41,$ff
+        dfb "@A"
+        lda #'a'
+        .encoding "petscii"
+        dfb "@"
+`)
+	if len(diagnostics) > 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	expectBytes(t, flatBytes(obj), "41 01 00 60 ff a9 01 40")
+	for _, src := range []string{"        .encoding ebcdic\n", "        .charmap 'ab',$00\n", "        .charmap 'a',$100\n", "        .charmap 'a'\n"} {
+		testAssemble(t, src)
+		if !hasDiagnostic(errs["encoding"][2]) {
+			t.Errorf("%q: got %v, want %s", src, diagnostics, errs["encoding"][2])
+		}
+	}
+}
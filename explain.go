@@ -0,0 +1,238 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> explain.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Long descriptions of each error code for ha6502 explain E0012. Codes never change once given
+// out; a new entry in errs takes the next free number, and retired codes such as E0040 aren't reused.
+
+type explanation struct {
+	about   string   // what the error means
+	causes  []string // common reasons for it
+	example string   // source or configuration that avoids it
+}
+
+var explanations = map[string]explanation{
+	"E0001": {"An .align directive needs a boundary from 1 to $8000 and may add a fill byte from 0 to $FF.",
+		[]string{"A boundary of 0 or more than $8000", "A fill value that doesn't fit in a byte", "More than two arguments"},
+		"        .align $100,$ea   ; next page, padded with nop"},
+	"E0002": {".zp allocates zero page variables from the area set with .zparea, and .zparea must lie within $00-$FF.",
+		[]string{"The zero page area is used up", ".zp without a name, or with a size below 1", ".zparea ending before it starts"},
+		"        .zparea $80,$ff\n        .zp ptr,2"},
+	"E0003": {"An .assert expression was false (0) once every address was known.",
+		[]string{"Code grew past a limit the assertion guards", "A table is not the size it was meant to be"},
+		"        .assert * <= $c000, \"code runs into the ROM\""},
+	"E0004": {"A jsr goes straight to a label in another bank. When it runs, whichever bank is switched into that window will be called instead.",
+		[]string{"Calling a routine in another bank without switching banks first", "Moving a routine to another bank's segment"},
+		"        lda #bank(level)\n        sta $ffff         ; the cartridge's bank register\n        jsr level"},
+	"E0005": {"A .struct or .enum block is not well formed.",
+		[]string{"A block inside another block", ".endstruct or .endenum without its start", "A .struct without a name", "A block left open at the end of the source"},
+		"point   .struct\nx       .res 1\ny       .res 1\n        .endstruct"},
+	"E0006": {"Segments that only reserve space, such as BSS and ZEROPAGE, can't hold code or data.",
+		[]string{"Code or dfb after .segment \"BSS\"", "A memory map marking a code segment bss"},
+		"        .segment \"BSS\"\nbuf:    .res 64\n        .segment \"CODE\""},
+	"E0007": {"A number written in the older hex form could not be read. Hex without $ needs an even number of digits.",
+		[]string{"An odd number of digits, e.g. equ 3", "A letter past F in a hex number"},
+		"count   equ $03\n        lda #03"},
+	"E0008": {"A .cycles block with an expected count took a different number of cycles, or it depends on branches and page crossings.",
+		[]string{"A change inside timed code", "A table crossing a page, adding a cycle to indexed reads"},
+		"        .cycles 6\n        lda #$00\n        sta $d020\n        .endcycles"},
+	"E0009": {"A name was defined twice, as a label, constant, import or variable.",
+		[]string{"Two labels with the same name", "A label with the same name as an equ", "A label that is also a .set variable"},
+		"loop1:  dex\n        bne loop1\nloop2:  dey\n        bne loop2"},
+	"E0010": {"With -far-branches, a branch that can't reach its target is assembled as the opposite branch over a jmp. This takes 3 more bytes.",
+		[]string{"A branch more than 127 bytes ahead or 128 bytes back"},
+		"        beq done          ; becomes bne *+5 and jmp done"},
+	"E0011": {"A file could not be read or written.",
+		[]string{"A misspelled file name", "A directory without write permission", "A file in use by another program"},
+		"ha6502 -xref prog.s"},
+	"E0012": {"Text could not be written in the current encoding.",
+		[]string{"A character the encoding has no code for", "An unknown .encoding name", "A bad escape such as \\q"},
+		"        .encoding petscii\nmsg:    dfb \"HELLO\",$00"},
+	"E0013": {"An expression could not be evaluated.",
+		[]string{"A name that isn't defined", "Division by zero", "Unbalanced parentheses", "A string where a number is needed"},
+		"size    equ $10\n        .assert size*2 == $20"},
+	"E0014": {"ha6502 fmt -case takes lower, upper or keep.",
+		[]string{"Another word after -case"},
+		"ha6502 fmt -case lower prog.s"},
+	"E0015": {"ha6502 fmt -cols takes three column positions: mnemonic, operand and comment.",
+		[]string{"Fewer or more than three numbers", "A negative position or one that isn't a number"},
+		"ha6502 fmt -cols 8,12,24 prog.s"},
+	"E0016": {"The output could not be written in the chosen -format.",
+		[]string{"A -format name that doesn't exist", "NES PRG outside $8000-$FFFF", "A banked memory map with a format other than raw", "-o65-size other than 16 or 32"},
+		"ha6502 -format prg prog.s"},
+	"E0017": {"A name given to .import is not a valid label.",
+		[]string{"A name starting with a digit", "Punctuation in the name"},
+		"        .import print,getkey"},
+	"E0018": {fmt.Sprintf("Labels can be at most %d characters long.", maxLabelLength),
+		[]string{"A long, descriptive label"},
+		"prtmsg: jsr $ffd2"},
+	"E0019": {"A hex address has more bytes than the instruction's operand holds.",
+		[]string{"A 2-byte address with an instruction that only has zero page modes", "A 2-byte address with an immediate"},
+		"        lda #$12\n        lda $1234"},
+	"E0020": {"The linker could not link the objects.",
+		[]string{"ld without -config", "A segment that the memory map doesn't list", "Objects without any code or data"},
+		"ha6502 ld -config map.cfg -o prog.bin main.obj lib.obj"},
+	"E0021": {"-cols takes four positive widths for the listing: address, label, bytes and line number.",
+		[]string{"Fewer or more than four numbers", "A width of 0"},
+		"ha6502 -cols 5,7,10,7 prog.s"},
+	"E0022": {"A .rept or .for block is not well formed.",
+		[]string{"A missing .endrept or .endfor", "A count below 0 or a step of 0", "An end without its start", "More than $10000 repeats"},
+		"        .for i = 0, 7\n        dfb i*2\n        .endfor"},
+	"E0023": {"A line of the memory map could not be read.",
+		[]string{"A line other than region or segment", "A missing start or size", "A region past $FFFF", "A segment in an undeclared region", "A bank above 255"},
+		"region  RAM  start=$0800 size=$0400\nsegment CODE region=RAM"},
+	"E0024": {"The line has no instruction or pseudo-op that ha6502 knows.",
+		[]string{"A mistyped mnemonic", "A pseudo-op without its dot, e.g. rept", "A code label without its colon", "An instruction from another CPU, such as the 65C02"},
+		"start:  lda #$00\n        .rept 4\n        inx\n        .endrept"},
+	"E0025": {"No source file was given.",
+		[]string{"Running ha6502 without a file name", "Flags after the file name"},
+		"ha6502 -xref prog.s"},
+	"E0026": {"A file given to the linker is not a readable ha6502 object.",
+		[]string{"Linking a source or flat image instead of a .obj", "An object from an older version", "A truncated file"},
+		"ha6502 -reloc main.s\nha6502 ld -config map.cfg main.obj"},
+	"E0027": {"The instruction has no such addressing mode. The detail lists the modes it does have.",
+		[]string{"sty or stx with an index register they can't use", "An immediate with a store", "jmp with a zero page indirect"},
+		"        ldx $10,y\n        stx $10,y"},
+	"E0028": {"The operand could not be read.",
+		[]string{"Extra text after the operand", "A value that doesn't fit in a byte or word", "A missing closing parenthesis"},
+		"        lda (ptr),y\n        dfb $01,$02\n        .word start"},
+	"E0029": {"A segment is bigger than the space left in its memory map region.",
+		[]string{"Code or tables that grew", "Two segments sharing a small region", "Alignment padding"},
+		"region ROM start=$c000 size=$4000"},
+	"E0030": {"org could not be used here.",
+		[]string{"org together with -map, where the memory map places each segment", "An org address that can't be read"},
+		"        org $0800\nstart:  rts"},
+	"E0031": {"Code or data between .page and .endpage crosses into another 256-byte page.",
+		[]string{"A table read with an index that straddles a page, costing a cycle", "Timed code that grew"},
+		"        .align $100\n        .page\ntbl:    dfb $01,$02,$03\n        .endpage"},
+	"E0032": {"The line could not be split into a label, mnemonic, operand and comment.",
+		[]string{"An unclosed quote", "A stray character", "An extra word after the operand"},
+		"msg:    dfb \"Hello\",$00  ; a comment"},
+	"E0033": {"Label addresses kept changing from one pass to the next, so the assembly never settled.",
+		[]string{"A .res or .align whose size depends on a label after it", "Far branches that keep changing each other's distances"},
+		"size    equ $10       ; a constant rather than a later label\n        .res size"},
+	"E0034": {"A .phase or .rorg block is not well formed.",
+		[]string{"A phased block inside another", ".dephase or .rend without its start", ".segment inside the block", "A block left open"},
+		"code:   .phase $0300\nrun:    jmp run\n        .dephase"},
+	"E0035": {"A branch target is more than 127 bytes ahead or 128 bytes back.",
+		[]string{"Code between the branch and its target grew", "A branch to a label in another routine"},
+		"        bne skip\n        jmp far\nskip:   nop"},
+	"E0036": {"A segment used in the source is not in the memory map.",
+		[]string{"A misspelled .segment name", "A memory map without a segment line for it"},
+		"segment DATA region=RAM"},
+	"E0037": {"Relocatable objects (-reloc) are placed by the linker, so they can't fix addresses.",
+		[]string{"org in a -reloc source", "A .phase block in a -reloc source", "An imported symbol used in a zero page or branch operand"},
+		"        .import print\n        jsr print"},
+	"E0038": {"A .proc or .scope block is not well formed.",
+		[]string{"A missing .endproc or .endscope", "Ending a .proc with .endscope", ".proc without a name"},
+		"        .proc print\nloop:   dex\n        bne loop\n        rts\n        .endproc"},
+	"E0039": {"The code runs past $FFFF.",
+		[]string{"An org too close to the top of memory", "A large .res or table"},
+		"        org $c000"},
+	"E0041": {"A listing, map or report could not be written.",
+		[]string{"A directory without write permission", "A full disk"},
+		"ha6502 prog.s"},
+	"E0042": {"ha6502 assembles one source file at a time.",
+		[]string{"Two file names", "A flag after the file name"},
+		"ha6502 -xref -cycles prog.s"},
+	"E0043": {"A name is used that isn't a label, constant, import or variable. The detail suggests the closest names.",
+		[]string{"A typo", "A label inside a .proc used from outside without its prefix, e.g. print::loop", "A name from another object without .import"},
+		"count   equ $03\n        ldx #count"},
+	"E0044": {"An object imports a name that no object exports.",
+		[]string{"A missing .export in the object that defines it", "Leaving an object off the ld command line"},
+		"        .export print     ; in lib.s\nprint:  rts"},
+	"E0045": {"The source raised an error with .error.",
+		[]string{"A configuration the source doesn't support", "A condition the author wanted to stop on"},
+		"        .error \"Not for this machine\""},
+	"E0046": {"The source printed a warning with .warning. Assembly continues.",
+		[]string{"A reminder the author left in the source"},
+		"        .warning \"Remove before release\""},
+	"E0047": {"A variable could not be set with = or .set.",
+		[]string{"Setting a label or constant", "A missing value", "A ]name on a line without = or .set"},
+		"]ptr    = $10\n]ptr    = ]ptr+2"},
+}
+
+// Shows the explanation of each code named, e.g. ha6502 explain E0012, or lists every code.
+// Codes can also be given as numbers (12) or by the errs key (relative). Returns how many
+// arguments weren't codes.
+func explainCodes(args []string) (unknown int) {
+	byCode := map[string]string{}
+	for key, err := range errs {
+		byCode[err[2]] = key
+	}
+	if len(args) == 0 {
+		var codes []string
+		for code := range byCode {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			err := errs[byCode[code]]
+			fmt.Println(code + "  " + setStringToWidth(err[0], 17) + err[1])
+		}
+		fmt.Println("\nUse ha6502 explain CODE for more about one of them.")
+		return 0
+	}
+	for _, arg := range args {
+		code := strings.ToUpper(arg)
+		if _, ok := byCode[code]; !ok {
+			var n int
+			if _, e := fmt.Sscanf(strings.TrimPrefix(code, "E"), "%d", &n); e == nil {
+				code = fmt.Sprintf("E%04d", n)
+			} else if err, ok := errs[arg]; ok {
+				code = err[2]
+			}
+		}
+		key, ok := byCode[code]
+		if !ok {
+			fmt.Println("\n" + arg + " is not an error code. Run ha6502 explain to list them.")
+			unknown++
+			continue
+		}
+		err, ex := errs[key], explanations[code]
+		fmt.Println("\n" + code + " " + err[0] + ": " + err[1] + "\n")
+		fmt.Println(ex.about + "\n")
+		fmt.Println("Common causes:")
+		for _, cause := range ex.causes {
+			fmt.Println("  - " + cause)
+		}
+		fmt.Print("\nFor example:\n\n")
+		fmt.Println(ex.example)
+	}
+	return
+}
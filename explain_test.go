@@ -0,0 +1,87 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> explain_test.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// Every registered code is raised somewhere in the sources and has an explanation
+func TestErrorCodesRaised(t *testing.T) {
+	files, _ := filepath.Glob("*.go")
+	raised := map[string]bool{}
+	rUse := regexp.MustCompile(`errs\["(\w+)"\]`)
+	for _, f := range files {
+		if strings.HasSuffix(f, "_test.go") {
+			continue
+		}
+		src, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range rUse.FindAllStringSubmatch(string(src), -1) {
+			raised[m[1]] = true
+		}
+	}
+	codes := map[string]string{}
+	for key, err := range errs {
+		if !raised[key] {
+			t.Errorf("%s (%s) is registered but never raised", err[2], key)
+		}
+		if other, ok := codes[err[2]]; ok {
+			t.Errorf("%s is used by both %s and %s", err[2], key, other)
+		}
+		codes[err[2]] = key
+		if _, ok := explanations[err[2]]; !ok {
+			t.Errorf("%s (%s) has no explanation", err[2], key)
+		}
+	}
+	for code := range explanations {
+		if _, ok := codes[code]; !ok {
+			t.Errorf("%s is explained but not registered", code)
+		}
+	}
+}
+
+func TestExplainUnknownCode(t *testing.T) {
+	quiet(t)
+	if n := explainCodes([]string{"E0012", "12", "relative"}); n != 0 {
+		t.Errorf("%d known codes reported as unknown", n)
+	}
+	if n := explainCodes([]string{"E9999", "E0012", "bogus"}); n != 2 {
+		t.Errorf("reported %d unknown codes, want 2", n)
+	}
+}
@@ -0,0 +1,343 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> expr.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Evaluates expressions for operands and directives such as .assert. Numbers are decimal, $hex,
+// %binary or a character such as 'A'; labels stand for their addresses and * for the address of the
+// current line. Operators, loosest first:
+//
+//	||  &&  |  ^  &  == !=  < <= > >=  << >>  + -  * / %
+//
+// Unary - ~ ! apply to the next value, as do < and > for its low and high byte. Comparisons and
+// logical operators give 1 for true and 0 for false. Functions are in funcs.go.
+type exprParser struct {
+	toks       []string
+	pos        int
+	pc         int      // value of *, -1 if not known yet
+	refs       []string // symbols used
+	unknown    []string // symbols not defined yet, which count as 0 when lenient
+	lenient    bool
+	unsized    []string // blocks not placed yet, whose size counts as 0 when deferSizes
+	deferSizes bool
+}
+
+var exprBinary = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"}}
+
+var exprPairs = map[string]bool{"||": true, "&&": true, "==": true, "!=": true, "<=": true, ">=": true, "<<": true, ">>": true}
+
+// Evaluates src with * standing for pc
+func evalExpr(src string, pc int) (int, error) {
+	p := exprParser{pc: pc}
+	val, e := p.eval(src)
+	for _, ref := range p.refs {
+		addReference(ref, "")
+	}
+	return val, e
+}
+
+// Evaluates an instruction's operand. Symbols that aren't defined yet, and * before the first pass
+// has placed the line, count as 0 and are listed in unknown so the caller can size the operand
+// for the worst case.
+func evalOperand(src string, pc int) (val int, refs []string, unknown []string, e error) {
+	p := exprParser{pc: pc, lenient: true}
+	val, e = p.eval(src)
+	return val, p.refs, p.unknown, e
+}
+
+// Evaluates an operand already read from its line, like evalOperand
+func evalTokens(toks []token, pc int) (val int, refs []string, unknown []string, e error) {
+	p := exprParser{pc: pc, lenient: true}
+	val, e = p.evalLexed(toks)
+	return val, p.refs, p.unknown, e
+}
+
+// Evaluates the expression of an equ. The size of a block that hasn't been placed yet counts as 0,
+// and sized tells the caller to work the value out again once a pass has placed it, as it does
+// for an expression using another such constant.
+func evalEquate(toks []token) (val int, sized bool, e error) {
+	p := exprParser{pc: -1, deferSizes: true}
+	val, e = p.evalLexed(toks)
+	sized = len(p.unsized) > 0
+	for _, ref := range p.refs {
+		addReference(ref, "")
+		sized = sized || sizedEquates[ref]
+	}
+	return
+}
+
+func (p *exprParser) eval(src string) (int, error) {
+	toks, err, _ := lex(src)
+	if err != "" {
+		return 0, errors.New(err)
+	}
+	return p.evalLexed(toks)
+}
+
+// Evaluates an expression split into numbers, names, strings and operators
+func (p *exprParser) evalLexed(toks []token) (int, error) {
+	if len(toks) == 0 {
+		return 0, errors.New("Expected an expression.")
+	}
+	for _, tok := range toks {
+		if tok.kind == "comment" {
+			return 0, errors.New("Unexpected ; in expression.")
+		}
+		p.toks = append(p.toks, tok.text)
+	}
+	val, e := p.binary(0)
+	if e != nil {
+		return 0, e
+	}
+	if p.pos < len(p.toks) {
+		return 0, fmt.Errorf("Unexpected %s in expression.", p.toks[p.pos])
+	}
+	return val, nil
+}
+
+func isExprWord(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == '.'
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return ""
+}
+
+// Parses operators at precedence level and tighter, left to right
+func (p *exprParser) binary(level int) (int, error) {
+	if level == len(exprBinary) {
+		return p.unary()
+	}
+	left, e := p.binary(level + 1)
+	for e == nil {
+		op := p.peek()
+		found := false
+		for _, o := range exprBinary[level] {
+			found = found || o == op
+		}
+		if !found {
+			break
+		}
+		p.pos++
+		var right int
+		if right, e = p.binary(level + 1); e == nil {
+			left, e = applyBinary(op, left, right)
+		}
+	}
+	return left, e
+}
+
+func applyBinary(op string, a, b int) (int, error) {
+	switch op {
+	case "||":
+		return boolInt(a != 0 || b != 0), nil
+	case "&&":
+		return boolInt(a != 0 && b != 0), nil
+	case "|":
+		return a | b, nil
+	case "^":
+		return a ^ b, nil
+	case "&":
+		return a & b, nil
+	case "==":
+		return boolInt(a == b), nil
+	case "!=":
+		return boolInt(a != b), nil
+	case "<":
+		return boolInt(a < b), nil
+	case "<=":
+		return boolInt(a <= b), nil
+	case ">":
+		return boolInt(a > b), nil
+	case ">=":
+		return boolInt(a >= b), nil
+	case "<<":
+		return a << uint(b), nil
+	case ">>":
+		return a >> uint(b), nil
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	}
+	if b == 0 {
+		return 0, errors.New("Division by zero in expression.")
+	}
+	if op == "/" {
+		return a / b, nil
+	}
+	return a % b, nil
+}
+
+func (p *exprParser) unary() (int, error) {
+	op := p.peek()
+	if op == "-" || op == "~" || op == "!" || op == "<" || op == ">" {
+		p.pos++
+		val, e := p.unary()
+		switch op {
+		case "-":
+			val = -val
+		case "~":
+			val = ^val
+		case "!":
+			val = boolInt(val == 0)
+		case "<":
+			val &= 0xff
+		case ">":
+			val = val >> 8 & 0xff
+		}
+		return val, e
+	}
+	return p.primary()
+}
+
+func (p *exprParser) primary() (int, error) {
+	tok := p.peek()
+	p.pos++
+	switch {
+	case tok == "":
+		return 0, errors.New("Expression ends too soon.")
+	case tok == "(":
+		val, e := p.binary(0)
+		if e == nil && p.peek() != ")" {
+			e = errors.New("Expected ) in expression.")
+		}
+		p.pos++
+		return val, e
+	case tok == "*":
+		if p.pc < 0 && p.lenient {
+			p.unknown = append(p.unknown, tok)
+			return 0, nil
+		}
+		return p.pc, nil
+	case tok[0] == '$' || tok[0] == '%' || tok[0] >= '0' && tok[0] <= '9':
+		return exprNumber(tok)
+	case tok[0] == '\'': // a character in the current encoding
+		bytes, e := encodeText(tok)
+		if e == nil && len(bytes) != 1 {
+			e = fmt.Errorf("%s is not a single character.", tok)
+		}
+		if e != nil {
+			return 0, e
+		}
+		return int(bytes[0]), nil
+	case tok[0] == '"':
+		return 0, fmt.Errorf("String %s can't be used as a number.", tok)
+	case isExprWord(tok[0]) || strings.HasPrefix(tok, "::") || tok[0] == ']':
+		if _, ok := exprFuncs[strings.ToLower(tok)]; ok && p.peek() == "(" {
+			p.pos++
+			return p.call(strings.ToLower(tok))
+		}
+		for _, name := range []string{tok, strings.ToLower(tok)} {
+			if val, ok := varValue(name); ok {
+				return val, nil
+			}
+			if sym, ok := lookupScoped(name); ok {
+				p.refs = append(p.refs, sym.label)
+				return sym.intAddr, nil
+			}
+		}
+		if p.lenient {
+			p.unknown = append(p.unknown, tok)
+			return 0, nil
+		}
+		return 0, fmt.Errorf("Unknown symbol %s in expression.", symbolHint(tok))
+	}
+	return 0, fmt.Errorf("Unexpected %s in expression.", tok)
+}
+
+func exprNumber(tok string) (int, error) {
+	var val int64
+	var e error
+	switch tok[0] {
+	case '$':
+		val, e = strconv.ParseInt(tok[1:], 16, 64)
+	case '%':
+		val, e = strconv.ParseInt(tok[1:], 2, 64)
+	default:
+		val, e = strconv.ParseInt(tok, 10, 64)
+	}
+	if e != nil {
+		return 0, fmt.Errorf("%s is not a number.", tok)
+	}
+	return int(val), nil
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Splits directive arguments at commas that aren't inside quotes or brackets
+func splitArgs(text string) (args []string) {
+	depth, start := 0, 0
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == '"' || c == '\'':
+			i = quoteEnd(text, i) - 1
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			args = append(args, strings.TrimSpace(text[start:i]))
+			start = i + 1
+		}
+	}
+	if rest := strings.TrimSpace(text[start:]); rest != "" || len(args) > 0 {
+		args = append(args, rest)
+	}
+	return
+}
@@ -0,0 +1,248 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> formats.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Output file formats, selected with -format
+var formats = map[string]string{
+	"applesingle": "AppleSingle file holding the image with ProDOS BIN type and load address",
+	"appledouble": "Plain image plus an AppleDouble ._ header with ProDOS BIN type and load address",
+	"dos33":       "Apple DOS 3.3 binary: load address and length, then the image",
+	"nes":         "iNES ROM: PRG from $8000-$FFFF, CHR from the CHR segment",
+	"o65":         "o65 relocatable executable with relocations, imports and exports",
+	"prg":         "Commodore program: 2-byte load address, then the image",
+	"raw":         "Flat image from the lowest to the highest address written",
+	"xex":         "Atari executable: one block per segment, run address at the start of CODE"}
+
+var formatExt = map[string]string{
+	"applesingle": ".as",
+	"appledouble": ".bin",
+	"dos33":       ".bin",
+	"nes":         ".nes",
+	"o65":         ".o65",
+	"prg":         ".prg",
+	"raw":         ".o",
+	"xex":         ".xex"}
+
+var nesMapper int = 0      // iNES mapper number
+var nesMirror string = "h" // iNES nametable mirroring, h or v
+
+type chunk struct {
+	addr int
+	data []byte
+}
+
+// Returns the segments that hold bytes, in address order, merging segments that follow each other
+func imageChunks(o objectFile, skip ...string) (chunks []chunk) {
+	for _, seg := range o.segments {
+		if seg.bss || seg.size == 0 || isSkipped(seg.name, skip) {
+			continue
+		}
+		chunks = append(chunks, chunk{segBase[seg.name], append([]byte{}, seg.data...)})
+	}
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].addr < chunks[j].addr })
+	var merged []chunk
+	for _, c := range chunks {
+		if n := len(merged) - 1; n >= 0 && merged[n].addr+len(merged[n].data) == c.addr {
+			merged[n].data = append(merged[n].data, c.data...)
+		} else {
+			merged = append(merged, c)
+		}
+	}
+	return merged
+}
+
+// Whether the object has a segment by that name with bytes in it
+func holdsBytes(o objectFile, name string) bool {
+	for _, seg := range o.segments {
+		if seg.name == name && !seg.bss && seg.size > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func isSkipped(name string, skip []string) bool {
+	for _, s := range skip {
+		if strings.EqualFold(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the flat image of the assembled segments and its start address
+func flatImage(o objectFile) ([]byte, int) {
+	var bases [][]int = [][]int{make([]int, len(o.segments))}
+	for i, seg := range o.segments {
+		bases[0][i] = segBase[seg.name]
+	}
+	if len(imageChunks(o)) == 0 {
+		return nil, 0
+	}
+	return linkImage(memMap, []objectFile{o}, bases)
+}
+
+// Writes the assembled segments in the chosen output format
+func saveFormatted(filename string, format string, o objectFile) {
+	var buf bytes.Buffer
+	le := func(n int) { binary.Write(&buf, binary.LittleEndian, uint16(n)) }
+	if format != "raw" && len(bankedRegions(memMap)) > 0 {
+		errHandler(errs["format"], "Banked images can only be written as raw.")
+		return
+	}
+	var image []byte
+	var start int
+	if format != "o65" { // o65 keeps the segments apart
+		image, start = flatImage(o)
+	}
+	switch format {
+	case "raw":
+		saveObjectFile(filename, [][]byte{image})
+		return
+	case "prg":
+		le(start)
+		buf.Write(image)
+	case "dos33":
+		le(start)
+		le(len(image))
+		buf.Write(image)
+	case "applesingle":
+		buf.Write(appleHeader(0x00051600, removePathFileExtension(filepath.Base(filename)), start, image))
+	case "appledouble":
+		saveObjectFile(filename, [][]byte{image})
+		filename = filepath.Join(filepath.Dir(filename), "._"+filepath.Base(filename))
+		buf.Write(appleHeader(0x00051607, filepath.Base(filename)[2:], start, nil))
+	case "xex":
+		le(0xffff)
+		var code int = -1
+		for _, c := range imageChunks(o) {
+			le(c.addr)
+			le(c.addr + len(c.data) - 1)
+			buf.Write(c.data)
+			if run := segBase["CODE"]; run >= c.addr && run < c.addr+len(c.data) && holdsBytes(o, "CODE") { // CODE may be merged with the segment before it
+				code = run
+			}
+		}
+		if code >= 0 { // RUNAD
+			le(0x02e0)
+			le(0x02e1)
+			le(code)
+		}
+	case "nes":
+		buf.Write(nesROM(o))
+	case "o65":
+		buf.Write(o65File(o, filepath.Base(filename)))
+	}
+	e := ioutil.WriteFile(filename, buf.Bytes(), 0644)
+	if e != nil {
+		errHandler(errs["file"])
+	}
+	fmt.Println("\nWrote " + strconv.Itoa(buf.Len()) + " bytes to " + filename + ".")
+}
+
+// Builds an AppleSingle or AppleDouble header. AppleSingle carries the data fork; AppleDouble
+// leaves it in the plain file beside the header.
+func appleHeader(magic uint32, name string, loadAddr int, data []byte) []byte {
+	type entry struct {
+		id   uint32
+		body []byte
+	}
+	var prodos bytes.Buffer
+	binary.Write(&prodos, binary.BigEndian, uint16(0xc3))            // access: destroy, rename, write, read
+	binary.Write(&prodos, binary.BigEndian, uint16(0x06))            // file type: BIN
+	binary.Write(&prodos, binary.BigEndian, uint32(loadAddr&0xffff)) // aux type: load address
+	entries := []entry{{3, []byte(name)}, {11, prodos.Bytes()}}
+	if data != nil {
+		entries = append(entries, entry{1, data})
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, magic)
+	binary.Write(&buf, binary.BigEndian, uint32(0x00020000))
+	buf.Write(make([]byte, 16))
+	binary.Write(&buf, binary.BigEndian, uint16(len(entries)))
+	offset := buf.Len() + 12*len(entries)
+	for _, e := range entries {
+		binary.Write(&buf, binary.BigEndian, e.id)
+		binary.Write(&buf, binary.BigEndian, uint32(offset))
+		binary.Write(&buf, binary.BigEndian, uint32(len(e.body)))
+		offset += len(e.body)
+	}
+	for _, e := range entries {
+		buf.Write(e.body)
+	}
+	return buf.Bytes()
+}
+
+// Builds an iNES ROM. PRG ROM is 16K if everything fits in $C000-$FFFF, otherwise 32K from $8000;
+// the CHR segment becomes CHR ROM in 8K units. Unused space is $FF.
+func nesROM(o objectFile) []byte {
+	var prgSize int = 0x4000
+	for _, c := range imageChunks(o, "CHR") {
+		if c.addr < 0x8000 {
+			errHandler(errs["format"], "NES PRG ROM must be between $8000 and $FFFF.")
+		}
+		if c.addr < 0xc000 {
+			prgSize = 0x8000
+		}
+	}
+	prg := bytes.Repeat([]byte{0xff}, prgSize)
+	for _, c := range imageChunks(o, "CHR") {
+		copy(prg[c.addr-(0x10000-prgSize):], c.data)
+	}
+	var chr []byte
+	for _, seg := range o.segments {
+		if strings.EqualFold(seg.name, "CHR") {
+			chr = append(chr, seg.data...)
+		}
+	}
+	if len(chr)%0x2000 != 0 {
+		chr = append(chr, bytes.Repeat([]byte{0xff}, 0x2000-len(chr)%0x2000)...)
+	}
+	var flags6 byte = byte(nesMapper&0x0f) << 4
+	if nesMirror == "v" {
+		flags6 |= 1
+	}
+	header := []byte{'N', 'E', 'S', 0x1a, byte(prgSize / 0x4000), byte(len(chr) / 0x2000), flags6, byte(nesMapper & 0xf0)}
+	header = append(header, make([]byte, 8)...)
+	return append(append(header, prg...), chr...)
+}
@@ -0,0 +1,198 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> formatter.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Source formatter: ha6502 fmt [-w | -check] file.s ...
+// Lines are split into label, mnemonic, operand and comment exactly as the assembler reads them, then
+// laid out in columns. Full-line comments and lines that can't be parsed are left alone.
+
+type formatConfig struct {
+	opCol        int    // column of the mnemonic
+	argCol       int    // column of the operand
+	commentCol   int    // column of trailing comments
+	mnemonicCase string // lower, upper or keep
+	hexCase      string // lower, upper or keep
+}
+
+func formatFiles(args []string) {
+	var cfg formatConfig
+	var cols string
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	fs.StringVar(&cols, "cols", "8,12,24", "columns of the mnemonic, operand and trailing comment")
+	fs.StringVar(&cfg.mnemonicCase, "case", "lower", "mnemonic case: lower, upper or keep")
+	fs.StringVar(&cfg.hexCase, "hex", "keep", "case of hex digits in operands: lower, upper or keep")
+	write := fs.Bool("w", false, "rewrite the files instead of printing them")
+	check := fs.Bool("check", false, "list files that are not formatted and exit with status 1")
+	fs.Parse(args)
+
+	cfgCols := strings.Split(cols, ",")
+	if len(cfgCols) != 3 {
+		errHandler(errs["fmtcols"])
+	}
+	var widths [3]int
+	for i, col := range cfgCols {
+		n, e := strconv.Atoi(strings.TrimSpace(col))
+		if e != nil || n < 0 {
+			errHandler(errs["fmtcols"])
+		}
+		widths[i] = n
+	}
+	cfg.opCol, cfg.argCol, cfg.commentCol = widths[0], widths[1], widths[2]
+	for _, c := range []string{cfg.mnemonicCase, cfg.hexCase} {
+		if c != "lower" && c != "upper" && c != "keep" {
+			errHandler(errs["fmtcase"])
+		}
+	}
+	if fs.NArg() == 0 {
+		errHandler(errs["nofile"])
+	}
+
+	var unformatted int = 0
+	for _, f := range fs.Args() {
+		file, e := ioutil.ReadFile(f)
+		if e != nil {
+			errHandler(errs["file"], f)
+		}
+		src := string(file)
+		out := formatSource(src, cfg)
+		switch {
+		case *check:
+			if out != src {
+				fmt.Println(f)
+				unformatted++
+			}
+		case *write:
+			if out != src {
+				if ioutil.WriteFile(f, []byte(out), 0644) != nil {
+					errHandler(errs["file"], f)
+				}
+			}
+		default:
+			fmt.Print(out)
+		}
+	}
+	if unformatted > 0 {
+		os.Exit(1)
+	}
+}
+
+func formatSource(src string, cfg formatConfig) string {
+	newline := "\n"
+	if strings.Contains(src, "\r\n") {
+		newline = "\r\n"
+	}
+	srcLines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	for i, line := range srcLines {
+		srcLines[i] = formatLine(line, cfg)
+	}
+	return strings.Join(srcLines, newline)
+}
+
+func formatLine(line string, cfg formatConfig) string {
+	label, mnemonic, operand, comment, ok := splitLine(line)
+	if !ok {
+		return strings.TrimRight(line, " \t")
+	}
+	if label == "" && mnemonic == "" { // blank or comment only
+		if comment == "" {
+			return ""
+		}
+		if code, _ := splitComment(line); code == "" { // comments in the first column stay there
+			return strings.TrimRight(comment, " \t")
+		}
+		return padTo("", cfg.commentCol) + strings.TrimRight(comment, " \t")
+	}
+	switch cfg.mnemonicCase {
+	case "lower":
+		mnemonic = strings.ToLower(mnemonic)
+	case "upper":
+		mnemonic = strings.ToUpper(mnemonic)
+	}
+	out := label
+	if mnemonic != "" {
+		out = padTo(out, cfg.opCol) + mnemonic
+	}
+	if operand != "" {
+		out = padTo(out, cfg.argCol) + formatHex(operand, cfg.hexCase)
+	}
+	if comment != "" {
+		out = padTo(out, cfg.commentCol) + strings.TrimRight(comment, " \t")
+	}
+	return out
+}
+
+// Pads a string with spaces to a column, or by one space if it's already past it
+func padTo(str string, col int) string {
+	if str == "" && col == 0 {
+		return ""
+	}
+	if len(str) >= col {
+		return str + " "
+	}
+	return str + strings.Repeat(" ", col-len(str))
+}
+
+// Changes the case of hex digits following a $
+func formatHex(operand string, hexCase string) string {
+	if hexCase == "keep" {
+		return operand
+	}
+	out := []byte(operand)
+	inHex := false
+	for i := 0; i < len(out); i++ {
+		switch c := out[i]; {
+		case c == '"' || c == '\'': // leave strings alone
+			i = quoteEnd(operand, i) - 1
+			inHex = false
+		case c == '$':
+			inHex = true
+		case inHex && strings.ContainsRune("0123456789abcdefABCDEF", rune(c)):
+			if hexCase == "upper" {
+				out[i] = strings.ToUpper(string(c))[0]
+			} else {
+				out[i] = strings.ToLower(string(c))[0]
+			}
+		default:
+			inHex = false
+		}
+	}
+	return string(out)
+}
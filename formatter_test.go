@@ -0,0 +1,58 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> formatter_test.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFormattedSourceAssembles(t *testing.T) {
+	src := `cout: equ $fbe4
+        org $0800
+start:  lda #$0a
+        sta $c0,x
+        jsr cout
+        jmp start
+        dfb $ff,$7f
+`
+	_, want := testAssemble(t, src)
+	for _, hexCase := range []string{"upper", "lower"} {
+		out := formatSource(src, formatConfig{8, 12, 24, "upper", hexCase})
+		_, got := testAssemble(t, out)
+		if len(diagnostics) > 0 {
+			t.Errorf("-hex %s: formatted source doesn't assemble: %v\n%s", hexCase, diagnostics, out)
+			continue
+		}
+		expectBytes(t, flatBytes(got), fmt.Sprintf("% x", flatBytes(want)))
+	}
+}
@@ -0,0 +1,178 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> funcs.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Built-in functions of the expression language, with how many arguments each takes (-1 for one
+// or more). defined and sizeof take a name, strlen a string, and the rest expressions.
+var exprFuncs = map[string]int{
+	"bank":    1,
+	"cos":     1,
+	"defined": 1,
+	"hi":      1,
+	"lo":      1,
+	"max":     -1,
+	"min":     -1,
+	"round":   1,
+	"sin":     1,
+	"sizeof":  1,
+	"strlen":  1,
+}
+
+// Calls a built-in function whose name and ( have been read
+func (p *exprParser) call(name string) (int, error) {
+	switch name {
+	case "defined", "sizeof":
+		arg := p.peek()
+		if arg == "" || !isExprWord(arg[0]) && !strings.HasPrefix(arg, "::") && arg[0] != ']' {
+			return 0, fmt.Errorf("%s() takes a name.", name)
+		}
+		p.pos++
+		if e := p.closeCall(name); e != nil {
+			return 0, e
+		}
+		if name == "defined" {
+			_, ok := lookupScoped(arg)
+			return boolInt(ok || isVariable(arg)), nil
+		}
+		return p.sizeOf(arg)
+	case "strlen":
+		arg := p.peek()
+		if !strings.HasPrefix(arg, `"`) {
+			return 0, errors.New("strlen() takes a string.")
+		}
+		p.pos++
+		if e := p.closeCall(name); e != nil {
+			return 0, e
+		}
+		chars, e := unquote(arg)
+		return len(chars), e
+	case "bank": // a banked label's bank; anything else gives bits 16-23
+		if arg := p.peek(); p.pos+1 < len(p.toks) && p.toks[p.pos+1] == ")" {
+			sym, ok := lookupScoped(arg)
+			if ok && sym.kind == "lbl" && relocatable && mapFilename == "" {
+				return 0, errors.New("bank() of a label needs the memory map (-map) in a relocatable object.")
+			}
+			if ok && symbolBank(sym) >= 0 {
+				p.pos += 2
+				p.refs = append(p.refs, sym.label)
+				return symbolBank(sym), nil
+			}
+		}
+	}
+	var args []int
+	for {
+		val, e := p.binary(0)
+		if e != nil {
+			return 0, e
+		}
+		args = append(args, val)
+		if p.peek() != "," {
+			break
+		}
+		p.pos++
+	}
+	if e := p.closeCall(name); e != nil {
+		return 0, e
+	}
+	if n := exprFuncs[name]; n > 0 && len(args) != n {
+		return 0, fmt.Errorf("%s() takes %d argument(s), not %d.", name, n, len(args))
+	}
+	x := args[0]
+	switch name {
+	case "lo":
+		return x & 0xff, nil
+	case "hi":
+		return x >> 8 & 0xff, nil
+	case "bank":
+		return x >> 16 & 0xff, nil
+	case "sin", "cos": // x in 256ths of a turn; the result is 8.8 fixed point
+		angle := float64(x) * 2 * math.Pi / 256
+		if name == "cos" {
+			return int(math.Round(math.Cos(angle) * 256)), nil
+		}
+		return int(math.Round(math.Sin(angle) * 256)), nil
+	case "round": // 8.8 fixed point to the nearest whole number
+		return (x + 0x80) >> 8, nil
+	}
+	for _, val := range args[1:] {
+		if name == "min" && val < x || name == "max" && val > x {
+			x = val
+		}
+	}
+	return x, nil
+}
+
+func (p *exprParser) closeCall(name string) error {
+	if p.peek() != ")" {
+		return fmt.Errorf("Expected ) after the arguments of %s().", name)
+	}
+	p.pos++
+	return nil
+}
+
+// The size of a struct, or the bytes from the start of a .proc or named .scope to its end. A
+// block's size is known once a pass has placed it.
+func (p *exprParser) sizeOf(name string) (int, error) {
+	for _, n := range scopedNames(name, curScope) {
+		if span, ok := scopeSpans[n+"::"]; ok {
+			if span[1] < len(passAddrs) && pass > 1 {
+				return passAddrs[span[1]] - passAddrs[span[0]], nil
+			}
+			if p.lenient {
+				p.unknown = append(p.unknown, name)
+				return 0, nil
+			}
+			if p.deferSizes {
+				p.unsized = append(p.unsized, name)
+				return 0, nil
+			}
+			return 0, fmt.Errorf("The size of %s isn't known yet.", name)
+		}
+		if structNames[n] {
+			sym, _ := lookupSymbol(n)
+			p.refs = append(p.refs, n)
+			return sym.intAddr, nil
+		}
+	}
+	if _, ok := lookupScoped(name); !ok && p.lenient {
+		p.unknown = append(p.unknown, name)
+		return 0, nil
+	}
+	return 0, fmt.Errorf("sizeof() needs a struct, .proc or .scope, not %s.", name)
+}
@@ -0,0 +1,103 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> funcs_test.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import "testing"
+
+func TestSizeofInEquate(t *testing.T) {
+	_, obj := testAssemble(t, `        org $1000
+        .proc print
+        lda #$00
+        rts
+        .endproc
+size    equ sizeof(print)
+twice   equ size*2
+        lda #size
+        lda #twice
+`)
+	if len(diagnostics) > 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	expectBytes(t, flatBytes(obj), "a9 00 60 a9 03 a9 06")
+}
+
+func TestSizeofBeforeBlock(t *testing.T) {
+	testAssemble(t, `size    equ sizeof(print)
+        .proc print
+        rts
+        .endproc
+`)
+	if !hasDiagnostic("E0013") {
+		t.Errorf("expected an expression error, got %v", diagnostics)
+	}
+}
+
+func TestFunctions(t *testing.T) {
+	testAssemble(t, `point   .struct
+xpos    .res 2
+ypos    .res 2
+        .endstruct
+start:  nop
+`)
+	for _, test := range []struct {
+		expr string
+		want int
+	}{
+		{"lo($1234)", 0x34},
+		{"hi($1234)", 0x12},
+		{"bank($123456)", 0x12},
+		{"min(5, 2, 9)", 2},
+		{"max(5, 2, 9)", 9},
+		{"max(-1)", -1},
+		{"sin(0)", 0},
+		{"sin(64)", 256},
+		{"cos(128)", -256},
+		{"sin(32)", 181},
+		{"round($0180)", 2},
+		{"round($017f)", 1},
+		{"128 + round(sin(64) * 127)", 255},
+		{`strlen("a\"b")`, 3},
+		{"defined(start)", 1},
+		{"defined(nowhere)", 0},
+		{"sizeof(point)", 4},
+		{"LO(start+1)", 1},
+	} {
+		if got, err := evalExpr(test.expr, 0); err != nil || got != test.want {
+			t.Errorf("%s = %d (%v), want %d", test.expr, got, err, test.want)
+		}
+	}
+	for _, expr := range []string{"lo($12, $34)", "min()", "strlen(5)", "sizeof(5)", "sizeof(start)", "hi($1234", "defined()"} {
+		if got, err := evalExpr(expr, 0); err == nil {
+			t.Errorf("%s = %d, want an error", expr, got)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> lexer.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A token of a source line. Columns count characters from 1, so tabs and UTF-8 text in strings and
+// comments don't throw them off.
+type token struct {
+	kind  string // name, number, string, char, op or comment
+	text  string
+	pos   int  // byte offset in the line
+	col   int  // column
+	space bool // whitespace comes before it
+}
+
+// A parsed source line: [label[:]] [mnemonic [operand]] [comment]. The mnemonic of an assignment
+// such as "count = 0" is =.
+type statement struct {
+	label    string // without its colon
+	colon    bool
+	mnemonic string  // as written
+	operand  string  // as written, without the space around it
+	compact  string  // the operand's tokens without the whitespace between them
+	arg      operand // the operand read into its addressing mode and expression, see readOperand
+	comment  string  // including the ; or *
+	err      string  // why the line couldn't be read
+	errCol   int
+}
+
+// Reads the tokens of a source line. A ; starts a comment anywhere outside quotes, and so does a *
+// in front of everything else on the line.
+func lexLine(line string) (toks []token, err string, errCol int) {
+	code := strings.TrimLeftFunc(line, unicode.IsSpace)
+	if strings.HasPrefix(code, "*") {
+		pos := len(line) - len(code)
+		return []token{{kind: "comment", text: code, pos: pos, col: utf8.RuneCountInString(line[:pos]) + 1}}, "", 0
+	}
+	return lex(line)
+}
+
+// Splits text into tokens. Whether the last token ended a value decides if % starts a binary
+// number or is the remainder operator.
+func lex(line string) (toks []token, err string, errCol int) {
+	value, space := false, false
+	for i := 0; i < len(line); {
+		c := line[i]
+		r, size := utf8.DecodeRuneInString(line[i:])
+		col := utf8.RuneCountInString(line[:i]) + 1
+		tok := token{pos: i, col: col, space: space}
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+			space = true
+			continue
+		case c == ';':
+			tok.kind, tok.text = "comment", line[i:]
+		case c == '"' || c == '\'':
+			end, ok := quoteClose(line, i)
+			if !ok {
+				return toks, "The quote has no closing quote.", col
+			}
+			tok.kind, tok.text = "string", line[i:end]
+			if c == '\'' {
+				tok.kind = "char"
+			}
+		case isExprWord(c) && (c < '0' || c > '9'):
+			tok.kind, tok.text = "name", line[i:nameEnd(line, i+1)]
+		case strings.HasPrefix(line[i:], "::") && isNameStart(line, i+2): // outside every scope
+			tok.kind, tok.text = "name", line[i:nameEnd(line, i+2)]
+		case c == ']' && isNameStart(line, i+1): // a Merlin-style variable
+			tok.kind, tok.text = "name", line[i:wordEnd(line, i+1)]
+		case c >= '0' && c <= '9' || c == '$' || c == '%' && !value:
+			tok.kind, tok.text = "number", line[i:wordEnd(line, i+1)]
+		case i+1 < len(line) && exprPairs[line[i:i+2]]:
+			tok.kind, tok.text = "op", line[i:i+2]
+		case strings.IndexByte("+-*/%&|^~!<>(),#:=", c) >= 0:
+			tok.kind, tok.text = "op", string(c)
+		default:
+			return toks, fmt.Sprintf("Unexpected %q.", r), col
+		}
+		toks = append(toks, tok)
+		i += len(tok.text)
+		space = false
+		value = tok.kind != "op" && tok.kind != "comment" || tok.text == ")" || tok.text == "*" && !value
+	}
+	return toks, "", 0
+}
+
+func wordEnd(line string, i int) int {
+	for i < len(line) && isExprWord(line[i]) {
+		i++
+	}
+	return i
+}
+
+// Names can be qualified with the scopes they're in, e.g. print::loop
+func nameEnd(line string, i int) int {
+	i = wordEnd(line, i)
+	for strings.HasPrefix(line[i:], "::") && isNameStart(line, i+2) {
+		i = wordEnd(line, i+2)
+	}
+	return i
+}
+
+func isNameStart(line string, i int) bool {
+	return i < len(line) && isExprWord(line[i]) && (line[i] < '0' || line[i] > '9')
+}
+
+// Whether a token is a value rather than an operator
+func isValueToken(tok token) bool {
+	return tok.kind != "op" && tok.kind != "comment"
+}
+
+// Reads a source line into its label, mnemonic, operand and comment. A label is a name followed by
+// a colon, or any name in front of the mnemonic that isn't a mnemonic itself.
+func parseStatement(line string) (stmt statement) {
+	toks, err, col := lexLine(line)
+	if err != "" {
+		stmt.err, stmt.errCol = err, col
+		return
+	}
+	if n := len(toks); n > 0 && toks[n-1].kind == "comment" {
+		stmt.comment = strings.TrimRightFunc(toks[n-1].text, unicode.IsSpace)
+		toks = toks[:n-1]
+	}
+	i := 0
+	if len(toks) > 1 && toks[0].kind == "name" && toks[1].text == ":" && !toks[1].space {
+		stmt.label, stmt.colon = toks[0].text, true
+		i = 2
+	} else if len(toks) > 0 && toks[0].kind == "name" && !isMnemonic(toks[0].text) {
+		stmt.label = toks[0].text
+		i = 1
+	}
+	if i < len(toks) && (toks[i].kind == "name" || i > 0 && toks[i].text == "=") { // = as in count = 0
+		stmt.mnemonic = toks[i].text
+		i++
+	}
+	if i == len(toks) {
+		return
+	}
+	ops := toks[i:]
+	for j, tok := range ops {
+		if j > 0 && tok.space && isValueToken(tok) && isValueToken(ops[j-1]) {
+			stmt.err, stmt.errCol = "Too many elements in line; did not expect "+tok.text+".", tok.col
+			return
+		}
+		stmt.compact += tok.text
+	}
+	last := ops[len(ops)-1]
+	stmt.operand = line[ops[0].pos : last.pos+len(last.text)]
+	stmt.arg = readOperand(ops)
+	return
+}
+
+// Reads every line of the source once; each pass works from the statements
+func parseSource(src []string) (stmts []statement) {
+	for _, line := range src {
+		stmts = append(stmts, parseStatement(line))
+	}
+	return
+}
+
+// The part of a line before its comment
+func lineCode(line string) string {
+	toks, _, _ := lexLine(line)
+	if n := len(toks); n > 0 && toks[n-1].kind == "comment" {
+		return line[:toks[n-1].pos]
+	}
+	return line
+}
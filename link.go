@@ -0,0 +1,245 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> link.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Links relocatable objects into a flat image laid out by a memory map: ha6502 ld -config map.cfg a.obj b.obj
+func linkObjects(args []string) {
+	fs := flag.NewFlagSet("ld", flag.ExitOnError)
+	config := fs.String("config", "", "memory map configuration file")
+	out := fs.String("o", "", "output image (default: first object with a .bin extension)")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		errHandler(errs["nofile"])
+	}
+	if *config == "" {
+		errHandler(errs["link"], "A memory map is required (-config file).")
+	}
+	if *out == "" {
+		*out = removePathFileExtension(fs.Arg(0)) + ".bin"
+	}
+	mm := loadMemoryMap(*config)
+	var objs []objectFile
+	for _, f := range fs.Args() {
+		objs = append(objs, readObject(f))
+	}
+
+	// place each object's fragment of a segment in the order of the memory map, then the objects
+	bases := make([][]int, len(objs))
+	for i, o := range objs {
+		bases[i] = make([]int, len(o.segments))
+		for j, seg := range o.segments {
+			bases[i][j] = -1
+			if findSegment(mm, seg.name) < 0 {
+				errHandler(errs["link"], "Segment "+seg.name+" in "+o.filename+" is not in the memory map.")
+			}
+		}
+	}
+	for s := range mm.segments {
+		for i, o := range objs {
+			for j, seg := range o.segments {
+				if strings.EqualFold(seg.name, mm.segments[s].name) {
+					bases[i][j] = placeSegment(&mm, s, seg.size, seg.align)
+				}
+			}
+		}
+	}
+
+	exports := map[string]int{}
+	exportedBy := map[string]string{}
+	for i, o := range objs {
+		for _, exp := range o.exports {
+			if prev, ok := exportedBy[exp.name]; ok {
+				errHandler(errs["duplicatesym"], exp.name+" is exported by "+prev+" and "+o.filename+".")
+			}
+			addr := exp.value
+			if exp.segment >= 0 {
+				addr += bases[i][exp.segment]
+			}
+			exports[exp.name] = addr
+			exportedBy[exp.name] = o.filename
+		}
+	}
+
+	for i, o := range objs {
+		for j, seg := range o.segments {
+			for _, r := range seg.relocs {
+				var addr int
+				if r.target == relSegment {
+					addr = bases[i][r.index] + r.addend
+				} else {
+					name := o.imports[r.index]
+					tmp, ok := exports[name]
+					if !ok {
+						errHandler(errs["unresolved"], name+" is imported by "+o.filename+".")
+						continue
+					}
+					addr = tmp + r.addend
+				}
+				patchRelocation(seg.data, r, addr, o.filename)
+			}
+			objs[i].segments[j] = seg
+		}
+	}
+
+	image, start := linkImage(mm, objs, bases)
+	saveObjectFile(*out, [][]byte{image})
+	saveFile(removePathFileExtension(*out)+".map", linkMap(mm, objs, bases, exports, exportedBy, *config, start, len(image)))
+}
+
+func patchRelocation(data []byte, r relocation, addr int, filename string) {
+	if r.size == relWord && r.offset+1 >= len(data) || r.offset >= len(data) {
+		errHandler(errs["object"], "Relocation outside of segment in "+filename+".")
+		return
+	}
+	switch r.size {
+	case relWord:
+		data[r.offset] = byte(addr & 0xff)
+		data[r.offset+1] = byte(addr >> 8 & 0xff)
+	case relLow:
+		data[r.offset] = byte(addr & 0xff)
+	case relHigh:
+		data[r.offset] = byte(addr >> 8 & 0xff)
+	}
+}
+
+// Builds the output image spanning every region that received bytes. Gaps are zero unless the
+// region has a fill value. Banked regions come first, from bankImage; start is where the rest of
+// the image goes in memory.
+func linkImage(mm memoryMap, objs []objectFile, bases [][]int) (image []byte, start int) {
+	var end int = -1
+	start = -1
+	var output = map[int]bool{}
+	banks := bankImage(mm, objs, bases)
+	for i, o := range objs {
+		for j, seg := range o.segments {
+			if !seg.bss && seg.size > 0 {
+				n := findRegion(mm, mm.segments[findSegment(mm, seg.name)].region)
+				if mm.regions[n].bank >= 0 {
+					continue
+				}
+				output[n] = true
+				if start < 0 || bases[i][j] < start {
+					start = bases[i][j]
+				}
+				if bases[i][j]+seg.size > end {
+					end = bases[i][j] + seg.size
+				}
+			}
+		}
+	}
+	for n := range output {
+		r := mm.regions[n]
+		if r.fill >= 0 {
+			if r.start < start {
+				start = r.start
+			}
+			if r.start+r.size > end {
+				end = r.start + r.size
+			}
+		}
+	}
+	if start < 0 {
+		if len(banks) == 0 {
+			errHandler(errs["link"], "The objects contain no code or data.")
+		}
+		return banks, 0
+	}
+	image = make([]byte, end-start)
+	for n := range output {
+		r := mm.regions[n]
+		if r.fill >= 0 {
+			for a := r.start; a < r.start+r.size; a++ {
+				image[a-start] = byte(r.fill)
+			}
+		}
+	}
+	for i, o := range objs {
+		for j, seg := range o.segments {
+			if !seg.bss && mm.regions[findRegion(mm, mm.segments[findSegment(mm, seg.name)].region)].bank < 0 {
+				copy(image[bases[i][j]-start:], seg.data)
+			}
+		}
+	}
+	return append(banks, image...), start
+}
+
+func linkMap(mm memoryMap, objs []objectFile, bases [][]int, exports map[string]int, exportedBy map[string]string, config string, start int, size int) (out string) {
+	out += info["title"] + "\n"
+	out += "Linked with memory map " + config + "\n"
+	out += setStringToWidth("\nSegments ", 75, "=") + "\n"
+	for _, s := range mm.segments {
+		for i, o := range objs {
+			for j, seg := range o.segments {
+				if strings.EqualFold(seg.name, s.name) {
+					out += setStringToWidth(seg.name, 10) + setStringToWidth(mm.regions[findRegion(mm, s.region)].name, 10)
+					out += fmt.Sprintf("$%04X  $%04X  $%04X  ", bases[i][j], bases[i][j]+seg.size-1, seg.size)
+					if seg.bss {
+						out += "bss  "
+					} else {
+						out += "     "
+					}
+					out += o.filename + "\n"
+				}
+			}
+		}
+	}
+	out += setStringToWidth("\nRegions ", 75, "=") + "\n"
+	for _, r := range mm.regions {
+		out += setStringToWidth(r.name, 10)
+		out += fmt.Sprintf("$%04X  $%04X  used $%04X of $%04X\n", r.start, r.start+r.size-1, r.used, r.size)
+	}
+	if len(exports) > 0 {
+		out += setStringToWidth("\nExports ", 75, "=") + "\n"
+		var names []string
+		for name := range exports {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			out += setStringToWidth(name, 10) + fmt.Sprintf("$%04X  ", exports[name]) + exportedBy[name] + "\n"
+		}
+	}
+	if banks := bankSummary(mm); banks != "" {
+		out += setStringToWidth("\nBanks ", 75, "=") + "\n" + banks
+		out += fmt.Sprintf("\nImage holds the banks, then fills $%04X onward. ($%04X bytes)\n", start, size)
+	} else {
+		out += fmt.Sprintf("\nImage fills $%04X through $%04X. ($%04X bytes)\n", start, start+size-1, size)
+	}
+	return
+}
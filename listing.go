@@ -0,0 +1,212 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> listing.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Layout and options for the assembly listing
+type listingConfig struct {
+	addrWidth  int  // address column
+	labelWidth int  // label column
+	bytesWidth int  // object code column; bytes that don't fit wrap onto extra rows
+	lineWidth  int  // source line number column
+	cycles     bool // show cycle counts for instructions
+	pages      bool // mark where the object code enters a new 256-byte page
+	expansions bool // show lines generated by an expansion
+}
+
+var listCfg = listingConfig{5, 7, 10, 7, false, true, true}
+
+// Sets the listing column widths from a comma-separated list, e.g. "5,7,10,7"
+func parseListColumns(spec string) {
+	cols := strings.Split(spec, ",")
+	if len(cols) != 4 {
+		errHandler(errs["listcols"])
+		return
+	}
+	var widths [4]int
+	for i, col := range cols {
+		w, e := strconv.Atoi(strings.TrimSpace(col))
+		if e != nil || w < 1 {
+			errHandler(errs["listcols"])
+			return
+		}
+		widths[i] = w
+	}
+	listCfg.addrWidth = widths[0]
+	listCfg.labelWidth = widths[1]
+	listCfg.bytesWidth = widths[2]
+	listCfg.lineWidth = widths[3]
+}
+
+func logAssembly(lines []string, insts []instruction, obj [][]byte) {
+	// addr | run addr when phased | sym | ops | cycles | line | file
+	var listing bool = true
+	var phased bool = isPhased()
+	var lastPage int = -1
+	perRow := (listCfg.bytesWidth - 1) / 3
+	if perRow < 1 {
+		perRow = 1
+	}
+	log += setStringToWidth("\nAssembly Listing ", 75, "=") + "\n"
+	for i, line := range obj {
+		inst := insts[i]
+		addr := lineAddrs[i]
+		if inst.mnemonic == ".list" {
+			listing = true
+		}
+		show := listing && (listCfg.expansions || inst.expansion == 0)
+		if inst.mnemonic == ".nolist" { // the .nolist line itself is still listed
+			listing = false
+		}
+		if show {
+			run := -1
+			if phased {
+				run = runAddr(i)
+			}
+			log += listRows(lines[sourceLine(i)], sourceLine(i)+1, inst, addr, run, line, perRow, &lastPage)
+			if block, ok := cycleTotals[i]; ok {
+				indent := listCfg.addrWidth + listCfg.labelWidth
+				if phased {
+					indent += 5
+				}
+				log += setStringToWidth("", indent) + "= " + cycleRange(block) + " cycles from line " + strconv.Itoa(sourceLine(block.start)+1) + "\n"
+			}
+		}
+	}
+	log += "\n" + fillSummary(insts, obj) + "\n"
+}
+
+// Describes the range of memory the object code fills. Banks share addresses, so each bank
+// gets its own range after the code outside the banks.
+func fillSummary(insts []instruction, obj [][]byte) string {
+	type span struct{ start, end int }
+	spans := map[int]*span{} // by bank, -1 outside the banks
+	segs := lineSegments(insts)
+	for i, line := range obj {
+		if len(line) == 0 {
+			continue
+		}
+		bank := segmentBank(segs[i])
+		s, ok := spans[bank]
+		if !ok {
+			s = &span{lineAddrs[i], lineAddrs[i] + len(line)}
+			spans[bank] = s
+		}
+		if lineAddrs[i] < s.start {
+			s.start = lineAddrs[i]
+		}
+		if lineAddrs[i]+len(line) > s.end {
+			s.end = lineAddrs[i] + len(line)
+		}
+	}
+	if len(spans) == 0 {
+		return "No object code was produced."
+	}
+	var banks []int
+	for bank := range spans {
+		banks = append(banks, bank)
+	}
+	sort.Ints(banks)
+	var out []string
+	for _, bank := range banks {
+		s := spans[bank]
+		what := "Object"
+		if bank >= 0 {
+			what = "Bank " + strconv.Itoa(bank)
+		}
+		out = append(out, fmt.Sprintf("%s will fill from $%04X through $%04X. ($%04X bytes)", what, s.start, s.end-1, s.end-s.start))
+	}
+	return strings.Join(out, "\n")
+}
+
+// Formats one source line of the listing, wrapping object bytes that don't fit onto extra rows.
+// A page marker precedes any row that starts on a different page than the last row listed.
+// When run isn't -1 the address the line runs at follows the address it is loaded at, but only
+// on lines in a .phase block.
+func listRows(src string, lineNo int, inst instruction, addr int, run int, obj []byte, perRow int, lastPage *int) (out string) {
+	for row := 0; row == 0 || row*perRow < len(obj); row++ {
+		last := (row + 1) * perRow
+		if last > len(obj) {
+			last = len(obj)
+		}
+		chunk := obj[row*perRow : last]
+		if len(chunk) > 0 {
+			page := (addr + row*perRow) >> 8
+			if listCfg.pages && *lastPage >= 0 && page != *lastPage {
+				out += setStringToWidth(fmt.Sprintf("---- page $%02X ", page), 75, "-") + "\n"
+			}
+			*lastPage = page
+			out += setStringToWidth(fmt.Sprintf("%04X", addr+row*perRow), listCfg.addrWidth)
+		} else {
+			out += setStringToWidth("", listCfg.addrWidth)
+		}
+		if run >= 0 {
+			if row == 0 && run != addr {
+				out += fmt.Sprintf("%04X ", run)
+			} else {
+				out += setStringToWidth("", 5)
+			}
+		}
+		if row == 0 && inst.label != "" && inst.kind != "pse" {
+			out += setStringToWidth(inst.label, listCfg.labelWidth)
+		} else {
+			out += setStringToWidth("", listCfg.labelWidth)
+		}
+		var tmp string
+		for _, op := range chunk {
+			tmp += fmt.Sprintf("%02X ", op)
+		}
+		out += setStringToWidth(tmp, listCfg.bytesWidth)
+		if listCfg.cycles {
+			if row == 0 && run >= 0 {
+				out += setStringToWidth(cycleText(inst, run), 5)
+			} else if row == 0 {
+				out += setStringToWidth(cycleText(inst, addr), 5)
+			} else {
+				out += setStringToWidth("", 5)
+			}
+		}
+		out += "| "
+		if row == 0 {
+			out += setStringToWidth(strconv.Itoa(lineNo)+strings.Repeat("+", inst.expansion), listCfg.lineWidth)
+			out += src
+		}
+		out += "\n"
+	}
+	return
+}
@@ -0,0 +1,135 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> listing_test.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Assembles src and returns the rows of its listing, without the heading and summary
+func testListing(t *testing.T, src string) []string {
+	t.Helper()
+	insts, obj := testAssemble(t, src)
+	if len(diagnostics) > 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	logAssembly(lines, insts, obj)
+	rows := strings.Split(log, "\n")
+	return rows[2 : len(rows)-3]
+}
+
+// Restores the default listing layout after the test
+func useListing(t *testing.T, cfg listingConfig) {
+	t.Helper()
+	saved := listCfg
+	listCfg = cfg
+	t.Cleanup(func() { listCfg = saved })
+}
+
+const listingSrc = `        org $08fd
+start:  lda $1234,x
+        dfb $01,$02,$03,$04,$05
+        bne start
+`
+
+func expectRows(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("listing\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// Bytes that don't fit the object code column wrap onto rows of their own, and a marker shows
+// where the code enters a new page
+func TestListingWrapsBytes(t *testing.T) {
+	useListing(t, listingConfig{5, 7, 10, 7, false, true, true})
+	expectRows(t, testListing(t, listingSrc),
+		"                      | 1              org $08fd",
+		"08FD start  BD 34 12  | 2      start:  lda $1234,x",
+		"---- page $09 -------------------------------------------------------------",
+		"0900        01 02 03  | 3              dfb $01,$02,$03,$04,$05",
+		"0903        04 05     | ",
+		"0905        D0 F6     | 4              bne start",
+		"                      | 5      ")
+}
+
+func TestListingCycles(t *testing.T) {
+	useListing(t, listingConfig{5, 7, 10, 7, true, false, true})
+	expectRows(t, testListing(t, listingSrc),
+		"                           | 1              org $08fd",
+		"08FD start  BD 34 12  4+   | 2      start:  lda $1234,x",
+		"0900        01 02 03       | 3              dfb $01,$02,$03,$04,$05",
+		"0903        04 05          | ",
+		"0905        D0 F6     2/4  | 4              bne start",
+		"                           | 5      ")
+}
+
+func TestListingColumns(t *testing.T) {
+	useListing(t, listCfg)
+	parseListColumns("6, 4,16,3")
+	expectRows(t, testListing(t, listingSrc),
+		"                          | 1          org $08fd",
+		"08FD  starBD 34 12        | 2  start:  lda $1234,x",
+		"---- page $09 -------------------------------------------------------------",
+		"0900      01 02 03 04 05  | 3          dfb $01,$02,$03,$04,$05",
+		"0905      D0 F6           | 4          bne start",
+		"                          | 5  ")
+	collectDiagnostics = true
+	defer func() { collectDiagnostics = false }()
+	for _, spec := range []string{"5,7,10", "5,7,0,7", "5,x,10,7"} {
+		diagnostics = nil
+		parseListColumns(spec)
+		if !hasDiagnostic(errs["listcols"][2]) {
+			t.Errorf("column widths %q accepted", spec)
+		}
+	}
+}
+
+// .nolist hides the lines after it until .list, and expanded lines can be left out
+func TestListingHidesLines(t *testing.T) {
+	useListing(t, listingConfig{5, 7, 10, 7, false, true, false})
+	expectRows(t, testListing(t, `        org $0800
+        .nolist
+        nop
+        .list
+        .rept 2
+        nop
+        .endrept
+`),
+		"                      | 1              org $0800",
+		"                      | 2              .nolist",
+		"                      | 4              .list",
+		"                      | 5              .rept 2",
+		"                      | 7              .endrept",
+		"                      | 8      ")
+}
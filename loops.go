@@ -0,0 +1,198 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> loops.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Repeated blocks: .rept count[, var] and .for var = start, end[, step], each closed by .endrept
+// or .endfor. Every pass assembles a block's body once per iteration, so the copies get addresses
+// like any other lines. The loop variable is an assembly-time variable (see vars.go) for the
+// length of the loop. Instructions are numbered in the order they are assembled, and lineNums
+// maps them back to the source.
+
+const maxRepeat int = 0x10000 // iterations allowed in one block
+
+var loopEnds = map[string]string{".for": ".endfor", ".rept": ".endrept"}
+
+var lineNums []int // source line of each instruction
+
+// Clears the loops at the start of each pass
+func resetLoops() {
+	lineNums = nil
+}
+
+// The source line an instruction came from. Copies made by a loop share their line.
+func sourceLine(i int) int {
+	if i >= 0 && i < len(lineNums) {
+		return lineNums[i]
+	}
+	return i
+}
+
+// Assembles the statements from..to, repeating the body of each loop in them
+func assembleLines(stmts []statement, from int, to int, depth int, insts []instruction) []instruction {
+	for j := from; j < to; j++ {
+		insts = assembleStatement(stmts, j, depth, insts)
+		inst := insts[len(insts)-1]
+		if _, ok := loopEnds[inst.mnemonic]; !ok {
+			if isLoopEnd(inst.mnemonic) {
+				errHandler(errs["loop"], inst.mnemonic+" without "+loopStart(inst.mnemonic)+".")
+			}
+			continue
+		}
+		insts[len(insts)-1].kind = "" // a label on the loop is the address of its first copy
+		end := matchingEnd(stmts, j, to)
+		if end < 0 {
+			errHandler(errs["loop"], "Block is missing its end.")
+			continue
+		}
+		name, values := loopValues(inst)
+		outer, wasSet := varValue(name)
+		for _, v := range values {
+			if name != "" {
+				setVar(name, v)
+			}
+			insts = assembleLines(stmts, j+1, end, depth+1, insts)
+		}
+		if name != "" && wasSet {
+			setVar(name, outer)
+		} else if name != "" && len(values) > 0 {
+			unsetVar(name)
+		}
+		insts = assembleStatement(stmts, end, depth, insts)
+		j = end
+	}
+	return insts
+}
+
+func assembleStatement(stmts []statement, j int, depth int, insts []instruction) []instruction {
+	curLine = len(insts)
+	lineNums = append(lineNums, j)
+	lineScopes = append(lineScopes, curScope)
+	lineVars = append(lineVars, asmVars)
+	inst := parseLine(stmts[j])
+	inst.expansion = depth
+	return append(insts, inst)
+}
+
+// Finds the line closing the loop opened on line start, skipping loops nested in it. Returns -1 if
+// it isn't closed before line to.
+func matchingEnd(stmts []statement, start int, to int) int {
+	var open []string
+	for j := start; j < to; j++ {
+		mnemonic := strings.ToLower(stmts[j].mnemonic)
+		if _, ok := loopEnds[mnemonic]; ok {
+			open = append(open, mnemonic)
+		} else if isLoopEnd(mnemonic) {
+			if loopEnds[open[len(open)-1]] != mnemonic {
+				return -1
+			}
+			if open = open[:len(open)-1]; len(open) == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+func isLoopEnd(mnemonic string) bool {
+	return loopStart(strings.ToLower(mnemonic)) != ""
+}
+
+func loopStart(end string) string {
+	for start, e := range loopEnds {
+		if e == end {
+			return start
+		}
+	}
+	return ""
+}
+
+// Works out the iterations of a loop: the name of its variable, if any, and the value it takes
+// each time round
+func loopValues(inst instruction) (name string, values []int) {
+	var start, end, step int = 0, 0, 1
+	args := inst.args
+	switch inst.mnemonic {
+	case ".rept":
+		if len(args) < 1 || len(args) > 2 {
+			errHandler(errs["loop"], "Expected a count and an optional variable, e.g. .rept 8 or .rept 8,i.")
+			return
+		}
+		count, e := evalExpr(args[0], -1)
+		if e != nil {
+			errHandler(errs["loop"], e.Error())
+			return
+		}
+		if len(args) == 2 {
+			name = strings.TrimSpace(args[1])
+		}
+		end = count - 1
+	case ".for":
+		var e error
+		first := strings.SplitN(strings.Join(args, ","), "=", 2)
+		args = splitArgs(first[len(first)-1])
+		if len(first) != 2 || len(args) < 2 || len(args) > 3 {
+			errHandler(errs["loop"], "Expected a variable, start, end and optional step, e.g. .for i = 0, 255.")
+			return
+		}
+		name = strings.TrimSpace(first[0])
+		if start, e = evalExpr(args[0], -1); e == nil {
+			if end, e = evalExpr(args[1], -1); e == nil && len(args) == 3 {
+				step, e = evalExpr(args[2], -1)
+			}
+		}
+		if e != nil {
+			errHandler(errs["loop"], e.Error())
+			return
+		}
+		if step == 0 {
+			errHandler(errs["loop"], "The step can't be 0.")
+			return
+		}
+	}
+	if name != "" && !rLabel.MatchString(name) {
+		errHandler(errs["loop"], name+" can't be a loop variable.")
+		return "", nil
+	}
+	for v := start; step > 0 && v <= end || step < 0 && v >= end; v += step {
+		if len(values) == maxRepeat {
+			errHandler(errs["loop"], fmt.Sprintf("The loop repeats more than %d times.", maxRepeat))
+			return name, nil
+		}
+		values = append(values, v)
+	}
+	return
+}
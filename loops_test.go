@@ -0,0 +1,101 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> loops_test.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import "testing"
+
+func TestRepeatBlocks(t *testing.T) {
+	for _, test := range []struct{ src, want string }{
+		{"        .rept 3\n        nop\n        .endrept\n", "ea ea ea"},
+		{"        .rept 0\n        nop\n        .endrept\n", ""},
+		{"        .rept 4, i\n        dfb i*2\n        .endrept\n", "00 02 04 06"},
+		{"        .for n = 0, 3\n        dfb n*n\n        .endfor\n", "00 01 04 09"},
+		{"        .for n = 10, 1, -4\n        dfb n\n        .endfor\n", "0a 06 02"},
+		{"        .for i = 1, 2\n        .rept 2, j\n        dfb i*$10+j\n        .endrept\n        .endfor\n", "10 11 20 21"},
+		{"count   equ $02\n        .rept count+1\n        dfb $ff\n        .endrept\n", "ff ff ff"},
+	} {
+		_, obj := testAssemble(t, test.src)
+		if len(diagnostics) > 0 {
+			t.Errorf("%q: unexpected diagnostics %v", test.src, diagnostics)
+			continue
+		}
+		expectBytes(t, flatBytes(obj), test.want)
+	}
+}
+
+// Each copy has its own address, and a label on the loop line is where the first copy starts
+func TestRepeatAddresses(t *testing.T) {
+	insts, obj := testAssemble(t, `        org $0800
+copy:   .rept 2, i
+        .scope
+loop:   lda $1000+i
+        bne loop
+        .endscope
+        .endrept
+        jmp copy
+`)
+	if len(diagnostics) > 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	expectBytes(t, flatBytes(obj), "ad 00 10 d0 fb ad 01 10 d0 fb 4c 00 08")
+	var copies []int
+	for i, inst := range insts {
+		if inst.mnemonic == "lda" {
+			copies = append(copies, lineAddrs[i])
+			if inst.expansion != 1 || sourceLine(i) != 3 {
+				t.Errorf("copy at $%04X: expansion %d from line %d, want 1 from line 4", lineAddrs[i], inst.expansion, sourceLine(i)+1)
+			}
+		}
+	}
+	if len(copies) != 2 || copies[0] != 0x0800 || copies[1] != 0x0805 {
+		t.Errorf("copies at %x", copies)
+	}
+}
+
+func TestRepeatErrors(t *testing.T) {
+	for _, test := range []struct{ src, err string }{
+		{"        .rept 2\n        nop\n", "loop"},
+		{"        nop\n        .endrept\n", "loop"},
+		{"        .rept 2\n        nop\n        .endfor\n", "loop"},
+		{"        .rept later\n        .endrept\nlater:  nop\n", "loop"},
+		{"        .rept 2, 9x\n        .endrept\n", "loop"},
+		{"        .for i = 0, 3, 0\n        .endfor\n", "loop"},
+		{"        .for i, 0, 3\n        .endfor\n", "loop"},
+		{"        .rept 100000\n        .endrept\n", "loop"},
+		{"        .rept 2\nlabel:  nop\n        .endrept\n", "duplicatesym"},
+	} {
+		testAssemble(t, test.src)
+		if !hasDiagnostic(errs[test.err][2]) {
+			t.Errorf("%q: got %v, want %s", test.src, diagnostics, errs[test.err][2])
+		}
+	}
+}
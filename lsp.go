@@ -0,0 +1,406 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> lsp.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Language server: ha6502 lsp speaks the Language Server Protocol over stdin and stdout so editors
+// can show diagnostics, jump to label definitions and references, and hover or complete mnemonics.
+
+var collectDiagnostics bool = false // record errors for the language server instead of printing them
+var diagnostics []diagnostic        // errors recorded while collectDiagnostics is set
+
+type diagnostic struct {
+	line     int
+	severity int // 1 for errors, 2 for warnings
+	category string
+	code     string
+	message  string
+}
+
+func addDiagnostic(severity int, err []string, deets ...string) {
+	msg := err[1]
+	if len(deets) > 0 {
+		msg += " " + deets[0]
+	}
+	line := sourceLine(curLine)
+	if len(lines) == 0 || line >= len(lines) {
+		line = 0
+	}
+	for _, d := range diagnostics {
+		if d.line == line && d.message == msg { // already reported by an earlier pass
+			return
+		}
+	}
+	diagnostics = append(diagnostics, diagnostic{line, severity, err[0], err[2], msg})
+}
+
+// What the server remembers about each open document from its last assembly
+type lspDocument struct {
+	lines    []string
+	symbols  []symbol
+	refs     []xref
+	lineNums []int    // source line of each instruction
+	scopes   []string // scope of each source line
+}
+
+// The source line of an instruction in the document, see sourceLine
+func (doc *lspDocument) sourceLine(i int) int {
+	if i >= 0 && i < len(doc.lineNums) {
+		return doc.lineNums[i]
+	}
+	return i
+}
+
+type lspMessage struct {
+	ID     *json.RawMessage `json:"id,omitempty"`
+	Method string           `json:"method,omitempty"`
+	Params json.RawMessage  `json:"params,omitempty"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspTextParams struct {
+	TextDocument struct {
+		URI  string `json:"uri"`
+		Text string `json:"text"`
+	} `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+	Position lspPosition `json:"position"`
+}
+
+var lspDocs = map[string]*lspDocument{}
+var lspOut io.Writer
+
+func serveLSP() {
+	lspOut = os.Stdout
+	os.Stdout = os.Stderr // keep stray output off the protocol stream
+	collectDiagnostics = true
+	in := bufio.NewReader(os.Stdin)
+	for {
+		body, e := readLSPMessage(in)
+		if e != nil {
+			return
+		}
+		var msg lspMessage
+		if json.Unmarshal(body, &msg) != nil {
+			continue
+		}
+		var params lspTextParams
+		json.Unmarshal(msg.Params, &params)
+		uri := params.TextDocument.URI
+		switch msg.Method {
+		case "initialize":
+			replyLSP(msg.ID, map[string]interface{}{
+				"capabilities": map[string]interface{}{
+					"textDocumentSync":   1, // full text on every change
+					"definitionProvider": true,
+					"referencesProvider": true,
+					"hoverProvider":      true,
+					"completionProvider": map[string]interface{}{"triggerCharacters": []string{"."}},
+				},
+				"serverInfo": map[string]string{"name": info["shortTitle"]},
+			})
+		case "textDocument/didOpen":
+			lspAssemble(uri, params.TextDocument.Text)
+		case "textDocument/didChange":
+			if n := len(params.ContentChanges); n > 0 {
+				lspAssemble(uri, params.ContentChanges[n-1].Text)
+			}
+		case "textDocument/didClose":
+			delete(lspDocs, uri)
+		case "textDocument/definition":
+			replyLSP(msg.ID, lspDefinition(uri, params.Position))
+		case "textDocument/references":
+			replyLSP(msg.ID, lspReferences(uri, params.Position))
+		case "textDocument/hover":
+			replyLSP(msg.ID, lspHover(uri, params.Position))
+		case "textDocument/completion":
+			replyLSP(msg.ID, lspCompletion(uri))
+		case "shutdown":
+			replyLSP(msg.ID, nil)
+		case "exit":
+			return
+		default:
+			if msg.ID != nil { // unsupported request
+				writeLSPMessage(map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID,
+					"error": map[string]interface{}{"code": -32601, "message": "Method not found"}})
+			}
+		}
+	}
+}
+
+func readLSPMessage(in *bufio.Reader) ([]byte, error) {
+	var length int = -1
+	for {
+		header, e := in.ReadString('\n')
+		if e != nil {
+			return nil, e
+		}
+		header = strings.TrimSpace(header)
+		if header == "" {
+			break
+		}
+		if strings.HasPrefix(strings.ToLower(header), "content-length:") {
+			length, _ = strconv.Atoi(strings.TrimSpace(header[len("content-length:"):]))
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("missing Content-Length")
+	}
+	body := make([]byte, length)
+	_, e := io.ReadFull(in, body)
+	return body, e
+}
+
+func writeLSPMessage(msg interface{}) {
+	body, _ := json.Marshal(msg)
+	fmt.Fprintf(lspOut, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func replyLSP(id *json.RawMessage, result interface{}) {
+	writeLSPMessage(map[string]interface{}{"jsonrpc": "2.0", "id": id, "result": result})
+}
+
+// Assembles a document and publishes its diagnostics. Nothing is written to disk.
+func lspAssemble(uri string, text string) {
+	src := splitSource(text)
+	func() {
+		defer func() {
+			if r := recover(); r != nil { // a line the parser could not survive
+				line := sourceLine(curLine)
+				if line >= len(src) {
+					line = len(src) - 1
+				}
+				diagnostics = append(diagnostics, diagnostic{line, 1, "Parser", errs["parser"][2], fmt.Sprint("Assembly stopped: ", r)})
+			}
+		}()
+		assemble(src)
+	}()
+	doc := &lspDocument{lines: src, symbols: symbols, refs: references, lineNums: lineNums, scopes: make([]string, len(src))}
+	for i, scope := range lineScopes {
+		if n := sourceLine(i); n < len(src) {
+			doc.scopes[n] = scope
+		}
+	}
+	lspDocs[uri] = doc
+	var diags []interface{}
+	for _, d := range diagnostics {
+		diags = append(diags, map[string]interface{}{
+			"range":    lspRange{lspPosition{d.line, 0}, lspPosition{d.line, len(src[d.line])}},
+			"severity": d.severity,
+			"code":     d.code,
+			"source":   info["shortTitle"],
+			"message":  d.category + ": " + d.message,
+		})
+	}
+	if diags == nil {
+		diags = []interface{}{}
+	}
+	writeLSPMessage(map[string]interface{}{"jsonrpc": "2.0", "method": "textDocument/publishDiagnostics",
+		"params": map[string]interface{}{"uri": uri, "diagnostics": diags}})
+}
+
+// Returns the word under the cursor: a label, possibly qualified with its scope, a mnemonic or a
+// directive
+func lspWord(doc *lspDocument, pos lspPosition) string {
+	if pos.Line < 0 || pos.Line >= len(doc.lines) {
+		return ""
+	}
+	line := doc.lines[pos.Line]
+	isWord := func(c byte) bool {
+		return c == '.' || c == '_' || c == ':' || c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z'
+	}
+	start, end := pos.Character, pos.Character
+	if start > len(line) {
+		return ""
+	}
+	for start > 0 && isWord(line[start-1]) {
+		start--
+	}
+	for end < len(line) && isWord(line[end]) {
+		end++
+	}
+	return strings.TrimRight(line[start:end], ":") // a label's colon
+}
+
+// Finds a whole-word occurrence of a label in a line, ignoring the comment
+func wordRange(line string, lineNo int, word string) lspRange {
+	lower := strings.ToLower(lineCode(line))
+	for from := 0; ; {
+		i := strings.Index(lower[from:], strings.ToLower(word))
+		if i < 0 {
+			break
+		}
+		i += from
+		before := i == 0 || !isLabelChar(lower[i-1])
+		after := i+len(word) >= len(lower) || !isLabelChar(lower[i+len(word)])
+		if before && after {
+			return lspRange{lspPosition{lineNo, i}, lspPosition{lineNo, i + len(word)}}
+		}
+		from = i + 1
+	}
+	return lspRange{lspPosition{lineNo, 0}, lspPosition{lineNo, 0}}
+}
+
+func isLabelChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+func lspSymbol(uri string, pos lspPosition) (*lspDocument, symbol, bool) {
+	doc, ok := lspDocs[uri]
+	if !ok {
+		return nil, symbol{}, false
+	}
+	word := strings.ToLower(lspWord(doc, pos))
+	scope := ""
+	if pos.Line < len(doc.scopes) {
+		scope = strings.ToLower(doc.scopes[pos.Line])
+	}
+	for _, name := range scopedNames(word, scope) {
+		for _, sym := range doc.symbols {
+			if strings.ToLower(sym.label) == name {
+				return doc, sym, true
+			}
+		}
+	}
+	return doc, symbol{}, false
+}
+
+func lspDefinition(uri string, pos lspPosition) interface{} {
+	doc, sym, ok := lspSymbol(uri, pos)
+	if !ok {
+		return nil
+	}
+	line := doc.sourceLine(sym.defLine)
+	if sym.kind == "imp" && line >= len(doc.lines) {
+		return nil
+	}
+	return lspLocation{uri, wordRange(doc.lines[line], line, localName(sym.label))}
+}
+
+func lspReferences(uri string, pos lspPosition) interface{} {
+	doc, sym, ok := lspSymbol(uri, pos)
+	if !ok {
+		return nil
+	}
+	line := doc.sourceLine(sym.defLine)
+	locs := []lspLocation{{uri, wordRange(doc.lines[line], line, localName(sym.label))}}
+	for _, ref := range doc.refs {
+		if line := doc.sourceLine(ref.line); ref.label == sym.label && line < len(doc.lines) {
+			locs = append(locs, lspLocation{uri, wordRange(doc.lines[line], line, localName(sym.label))})
+		}
+	}
+	return locs
+}
+
+func lspHover(uri string, pos lspPosition) interface{} {
+	doc, ok := lspDocs[uri]
+	if !ok {
+		return nil
+	}
+	word := strings.ToLower(lspWord(doc, pos))
+	var text string
+	if desc, ok := mnemonics[word]; ok {
+		text = "**" + word + "** " + desc + "\n\n| mode | example | opcode | bytes | cycles |\n|---|---|---|---|---|\n"
+		for _, mode := range addrModes {
+			if op, ok := mode.table[word]; ok {
+				text += fmt.Sprintf("| %s | `%s %s` | $%02X | %d | %d |\n", mode.name, word, mode.example, op, mode.length, opCycles[op])
+			}
+		}
+	} else if desc, ok := pseudoOps[word]; ok {
+		text = "**" + word + "** " + desc
+	} else if _, sym, ok := lspSymbol(uri, pos); ok {
+		switch sym.kind {
+		case "imp":
+			text = "**" + sym.label + "** imported from another object"
+		case "equ":
+			text = fmt.Sprintf("**%s** = $%04X (equ, line %d)", sym.label, sym.intAddr, doc.sourceLine(sym.defLine)+1)
+		default:
+			text = fmt.Sprintf("**%s** = $%04X (%s, line %d)", sym.label, sym.intAddr, sym.segment, doc.sourceLine(sym.defLine)+1)
+		}
+	} else {
+		return nil
+	}
+	return map[string]interface{}{"contents": map[string]string{"kind": "markdown", "value": text}}
+}
+
+func lspCompletion(uri string) interface{} {
+	const kindFunction, kindKeyword, kindVariable = 3, 14, 6
+	var items []map[string]interface{}
+	var names []string
+	for name := range mnemonics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		items = append(items, map[string]interface{}{"label": name, "kind": kindFunction, "detail": mnemonics[name]})
+	}
+	names = nil
+	for name := range pseudoOps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		items = append(items, map[string]interface{}{"label": name, "kind": kindKeyword, "detail": pseudoOps[name]})
+	}
+	if doc, ok := lspDocs[uri]; ok {
+		for _, sym := range doc.symbols {
+			items = append(items, map[string]interface{}{"label": sym.label, "kind": kindVariable, "detail": fmt.Sprintf("$%04X", sym.intAddr)})
+		}
+	}
+	return items
+}
@@ -0,0 +1,158 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> lsp_test.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const lspURI = "file:///test.s"
+
+// Opens a document in the language server and returns the diagnostics it publishes
+func lspOpen(t *testing.T, text string) (diags []struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+}) {
+	t.Helper()
+	var out bytes.Buffer
+	lspOut = &out
+	collectDiagnostics = true
+	defer func() { collectDiagnostics = false }()
+	lspAssemble(lspURI, text)
+	t.Cleanup(func() { delete(lspDocs, lspURI) })
+	body, err := readLSPMessage(bufio.NewReader(&out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg struct {
+		Method string `json:"method"`
+		Params struct {
+			URI         string `json:"uri"`
+			Diagnostics []struct {
+				Range    lspRange `json:"range"`
+				Severity int      `json:"severity"`
+				Code     string   `json:"code"`
+				Message  string   `json:"message"`
+			} `json:"diagnostics"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Method != "textDocument/publishDiagnostics" || msg.Params.URI != lspURI {
+		t.Fatalf("published %s for %s", msg.Method, msg.Params.URI)
+	}
+	return msg.Params.Diagnostics
+}
+
+const lspSrc = `        org $0800
+start:  lda #$00
+        .proc print
+loop:   jsr $fded
+        bne loop
+        .endproc
+        jsr print
+        jmp start
+`
+
+func TestLSPDiagnostics(t *testing.T) {
+	if diags := lspOpen(t, lspSrc); len(diags) != 0 {
+		t.Errorf("clean source has diagnostics %v", diags)
+	}
+	diags := lspOpen(t, `        org $0800
+        lda #$00
+        .rept 2
+        lad #$00
+        .endrept
+        jmp nowhere
+`)
+	if len(diags) != 2 {
+		t.Fatalf("got diagnostics %v, want one for lines 4 and 6", diags)
+	}
+	// the error in the repeated line is reported once, on the line in the source
+	if d := diags[0]; d.Range.Start.Line != 3 || d.Range.End.Character != len("        lad #$00") || d.Severity != 1 {
+		t.Errorf("first diagnostic %+v", d)
+	}
+	if d := diags[1]; d.Range.Start.Line != 5 || !strings.Contains(d.Message, "nowhere") {
+		t.Errorf("second diagnostic %+v", d)
+	}
+}
+
+func TestLSPDefinitionAndReferences(t *testing.T) {
+	lspOpen(t, lspSrc)
+	loc, ok := lspDefinition(lspURI, lspPosition{7, 13}).(lspLocation) // jmp start
+	if !ok || loc.Range != (lspRange{lspPosition{1, 0}, lspPosition{1, 5}}) {
+		t.Errorf("definition of start at %v", loc)
+	}
+	// loop is local to print, so it's found from inside the block
+	loc, ok = lspDefinition(lspURI, lspPosition{4, 13}).(lspLocation)
+	if !ok || loc.Range.Start.Line != 3 {
+		t.Errorf("definition of loop at %v", loc)
+	}
+	if lspDefinition(lspURI, lspPosition{7, 2}) != nil {
+		t.Error("definition found for blank space")
+	}
+	locs, _ := lspReferences(lspURI, lspPosition{2, 15}).([]lspLocation) // .proc print
+	var got []int
+	for _, l := range locs {
+		got = append(got, l.Range.Start.Line)
+	}
+	if len(got) != 2 || got[0] != 2 || got[1] != 6 {
+		t.Errorf("references to print on lines %v, want [2 6]", got)
+	}
+}
+
+func TestLSPHover(t *testing.T) {
+	lspOpen(t, lspSrc)
+	hover := func(line, char int) string {
+		h, ok := lspHover(lspURI, lspPosition{line, char}).(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		return h["contents"].(map[string]string)["value"]
+	}
+	if text := hover(1, 9); !strings.Contains(text, "| immediate | `lda #$44` | $A9 | 2 | 2 |") {
+		t.Errorf("hover on lda:\n%s", text)
+	}
+	if text := hover(7, 14); !strings.Contains(text, "**start** = $0800") {
+		t.Errorf("hover on start: %s", text)
+	}
+	if text := hover(0, 0); text != "" {
+		t.Errorf("hover on blank space: %s", text)
+	}
+}
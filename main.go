@@ -33,10 +33,10 @@ package main
 
 import (
 	"encoding/hex"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -51,6 +51,13 @@ var info = map[string]string{
 }
 
 var continueOnError bool = false
+var errorCount int = 0           // errors reported while continuing on error
+var reported = map[string]bool{} // diagnostics already printed, by line and code, so later passes don't repeat them
+var writeXref bool = false
+var relocatable bool = false // emit a relocatable object for the linker instead of a flat image
+var mapFilename string = ""  // memory map configuration for segments
+var outFormat string = "raw" // output file format, see formats
+var farBranches bool = false // turn out of range branches into an inverted branch over a jmp
 
 type instruction struct {
 	mnemonic   string
@@ -61,6 +68,13 @@ type instruction struct {
 	opHighByte byte
 	label      string
 	isComment  bool
+	data       []byte    // object bytes for data pseudo-ops
+	dataRefs   []dataRef // label behind each data byte, if any
+	symRef     string    // label used as the operand, if any
+	symOffset  int       // constant added to symRef, e.g. 1 for tbl+1
+	symByte    string    // "<" or ">" when an immediate holds the low or high byte of symRef
+	args       []string  // arguments of pseudo-ops that take a list of names
+	expansion  int       // nesting depth for lines generated by an expansion
 }
 
 type symbol struct {
@@ -68,73 +82,206 @@ type symbol struct {
 	addLowByte  byte
 	addHighByte byte
 	intAddr     int
+	defLine     int    // line where the symbol is defined
+	kind        string // lbl (code label), equ (constant) or imp (imported)
+	segment     string // segment a code label belongs to
 }
 
 // Consts
 const comchars string = ";*"
+const maxPasses int = 8 // passes allowed for symbol addresses to settle
 
 // const modchars string = "#$"
 const maxLabelLength int = 7
 
 // Globals
-var filename string    // input file path
-var ofilename string   // output file path
-var logfilename string // log output path
-var curLine int = 0    // set to 0 when not testing
-var org int = 0        // where to start the code (just for the log)
-var pass int = 1       // which pass is underway
-var symbols []symbol   // symbol table
-var lines []string     // lines from the input file
-var log string         // log of output text
+var filename string           // input file path
+var ofilename string          // output file path
+var logfilename string        // log output path
+var curLine int = 0           // set to 0 when not testing
+var org int = 0               // where to start the code (just for the log)
+var pass int = 1              // which pass is underway
+var symbols []symbol          // symbol table
+var lines []string            // lines from the input file
+var log string                // log of output text
+var lineAddrs []int           // address of each line's object code
+var references []xref         // symbol references found in the final pass
+var passAddrs []int           // address of each line as of the last pass
+var farLines = map[int]bool{} // lines whose branch became an inverted branch over a jmp
 
 func main() {
-	var pass1Inst []instruction
-	var pass2Inst []instruction
+	if len(os.Args) > 1 && os.Args[1] == "ld" {
+		fmt.Println(info["title"] + "\n" + info["github"])
+		linkObjects(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "lsp" {
+		serveLSP()
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		formatFiles(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "explain" {
+		if explainCodes(os.Args[2:]) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	var listCols string
+	flag.StringVar(&listCols, "cols", "5,7,10,7", "listing column widths: address,label,bytes,line")
+	flag.BoolVar(&listCfg.cycles, "cycles", false, "show instruction cycle counts in the listing")
+	flag.BoolVar(&listCfg.pages, "pages", true, "mark page boundaries in the listing")
+	flag.BoolVar(&listCfg.expansions, "expand", true, "show expanded lines in the listing")
+	flag.BoolVar(&writeXref, "xref", false, "also write the cross-reference report to a .xref file")
+	flag.BoolVar(&relocatable, "reloc", false, "write a relocatable .obj for the linker instead of a flat image")
+	flag.StringVar(&mapFilename, "map", "", "memory map configuration placing segments in memory")
+	flag.StringVar(&outFormat, "format", "raw", "output format: raw, prg, dos33, applesingle, appledouble, xex, nes or o65")
+	flag.IntVar(&nesMapper, "nes-mapper", 0, "iNES mapper number for -format nes")
+	flag.StringVar(&nesMirror, "nes-mirror", "h", "iNES mirroring for -format nes: h or v")
+	flag.IntVar(&o65Size, "o65-size", 16, "size of o65 header values for -format o65: 16 or 32")
+	flag.BoolVar(&farBranches, "far-branches", false, "assemble out of range branches as an inverted branch over a jmp")
+	flag.BoolVar(&watchMode, "watch", false, "reassemble whenever the source changes and show what moved")
+	flag.Parse()
 
 	fmt.Println(info["title"] + "\n" + info["github"])
 
-	if len(os.Args) <= 1 {
+	parseListColumns(listCols)
+	if _, ok := formats[outFormat]; !ok {
+		errHandler(errs["format"], "Choose one of raw, prg, dos33, applesingle, appledouble, xex, nes or o65.")
+	}
+	if o65Size != 16 && o65Size != 32 {
+		errHandler(errs["format"], "The o65 size must be 16 or 32.")
+	}
+
+	if flag.NArg() < 1 {
 		errHandler(errs["nofile"])
-	} else if len(os.Args) == 2 {
-		filename = os.Args[1]
-		ofilename = removePathFileExtension(filename) + ".o"
+	} else if flag.NArg() == 1 {
+		filename = flag.Arg(0)
+		ofilename = removePathFileExtension(filename) + formatExt[outFormat]
+		if relocatable {
+			ofilename = removePathFileExtension(filename) + ".obj"
+		}
 		logfilename = removePathFileExtension(filename) + ".log"
 	} else {
 		errHandler(errs["toomanyargs"])
 	}
 
-	lines = loadFile(filename)
-
-	var objectCode [][]byte
-
-	pass1Inst = runPass(lines, pass1Inst)
-
-	getOrg(pass1Inst)
-	getSymbols(pass1Inst)
-
-	pass++
+	if watchMode {
+		watchSource()
+		return
+	}
 
-	pass2Inst = runPass(lines, pass2Inst)
+	build()
+	fmt.Print(log + "\n")
+}
 
-	objectCode = asmObject(pass2Inst)
+// Assembles the source file and writes the object, listing and reports. Nothing is written if
+// errors were reported while continuing on error.
+func build() (pass2Inst []instruction, objectCode [][]byte) {
+	pass2Inst, objectCode = assemble(loadFile(filename))
+	if errorCount > 0 {
+		return
+	}
 
-	logAssembly(lines, objectCode)
+	logAssembly(lines, pass2Inst, objectCode)
 	logSymbolTable()
-	saveObjectFile(ofilename, objectCode)
+	xrefReport := crossReference()
+	log += xrefReport
+	if relocatable {
+		writeObject(ofilename, buildObject(pass2Inst, objectCode))
+	} else {
+		saveFormatted(ofilename, outFormat, buildObject(pass2Inst, objectCode))
+	}
+	if writeXref {
+		saveFile(removePathFileExtension(filename)+".xref", strings.TrimLeft(xrefReport, "\n"))
+	}
 
 	now := time.Now()
 	nowstr := now.Format(time.RFC850) + "\n"
 	nowstr += ofilename + "\n"
 	saveFile(logfilename, nowstr+log)
-
-	fmt.Print(log + "\n")
+	return
 }
 
-func runPass(lines []string, insts []instruction) []instruction {
-	for i, line := range lines {
-		curLine = i
-		insts = append(insts, parseLine(line))
+// Runs passes over the source until every label keeps its address from one pass to the next, then
+// returns the final instructions and their object code. Pass 1 sizes operands that use labels not
+// yet defined; later passes size them with the addresses the previous pass found.
+func assemble(src []string) (insts []instruction, objectCode [][]byte) {
+	resetState()
+	lines = src
+	if mapFilename != "" {
+		memMap = loadMemoryMap(mapFilename)
 	}
+
+	stmts := parseSource(lines)
+	insts = runPass(stmts)
+
+	getOrg(insts)
+	getSymbols(insts)
+
+	for {
+		pass++
+		references = nil
+		insts = runPass(stmts)
+		changed := getSymbols(insts)
+		if len(changed) == 0 {
+			break
+		}
+		if pass >= maxPasses {
+			curLine = changed[0].defLine
+			errHandler(errs["phase"], "Still moving after "+strconv.Itoa(maxPasses)+" passes: "+describeChanges(changed))
+			break
+		}
+	}
+	checkOverflows()
+
+	objectCode = asmObject(insts)
+	checkCycles(insts)
+	checkPages(insts, objectCode)
+	checkBanks(insts)
+	checkDirectives(insts)
+	return
+}
+
+// Clears everything left over from a previous assembly
+func resetState() {
+	curLine = 0
+	org = 0
+	pass = 1
+	symbols = nil
+	lines = nil
+	log = ""
+	lineAddrs = nil
+	references = nil
+	diagnostics = nil
+	errorCount = 0
+	reported = map[string]bool{}
+	passAddrs = nil
+	runOffsets = nil
+	cycleTotals = map[int]cycleBlock{}
+	farLines = map[int]bool{}
+	segNames = nil
+	segBase = map[string]int{}
+	memMap = memoryMap{}
+	scopeSpans = map[string][2]int{}
+	sizedEquates = map[string]bool{}
+	structNames = map[string]bool{}
+}
+
+func runPass(stmts []statement) (insts []instruction) {
+	resetBlocks()
+	resetEncoding()
+	resetScopes()
+	resetLoops()
+	resetVars()
+	resetPhase()
+	insts = assembleLines(stmts, 0, len(stmts), 0, nil)
+	checkBlocks()
+	checkScopes()
+	checkPhase()
 	return insts
 }
 
@@ -143,184 +290,315 @@ func loadFile(filename string) (lines []string) {
 	if e != nil {
 		errHandler(errs["file"])
 	}
-	lines = strings.Split(string(file), "\n")
-	return lines
+	return splitSource(string(file))
 }
 
-// Parses each line. Strips comments. Checks for labels and assigns mnemonics. Handles pseudo-ops.
-func parseLine(line string) (cur instruction) {
-	if len(line) == 0 { // ignore blank lines
-		cur.isComment = true
+// Splits source text into lines, dropping a byte order mark and the carriage returns of CRLF files
+func splitSource(text string) []string {
+	text = strings.TrimPrefix(text, "\ufeff")
+	return strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+}
+
+// Turns a statement into an instruction. Checks labels and assigns mnemonics. Handles pseudo-ops.
+func parseLine(stmt statement) (cur instruction) {
+	cur.isComment = true
+	if stmt.err != "" {
+		errHandler(errs["parser"], stmt.err+" (column "+strconv.Itoa(stmt.errCol)+")")
 		return cur
 	}
-	if strings.ContainsAny(line, comchars) { // strip comments
-		for _, char := range comchars {
-			line = strings.Split(line, string(char))[0]
-		}
-		if len(strings.TrimSpace(line)) == 0 { // if the entire line is a comment
-			cur.isComment = true
-			return cur
-		}
+	if stmt.label == "" && stmt.mnemonic == "" && stmt.operand == "" { // blank or comment
+		return cur
 	}
-	cur.isComment = false
-	lineArr := strings.Fields(line)
-	if len(lineArr) > 0 && len(lineArr) < 4 {
-		if rLabelCol.MatchString(lineArr[0]) {
-			cur.label = strings.ReplaceAll(lineArr[0], ":", "")
-			if len(cur.label) > maxLabelLength {
-				errHandler(errs["labelLength"])
-			}
-			if len(lineArr) > 1 {
-				if isMnemonic(lineArr[1]) { // mnemonic, label
-					cur.mnemonic = strings.ToLower(lineArr[1])
-					if len(lineArr) == 2 {
-						cur.kind = "zop"
-						cur.length = 1
-					}
-				} else {
-					errHandler(errs["mnemonic"])
-				}
-				if len(lineArr) > 2 {
-					cur = parseOperand(lineArr[2], cur)
-				}
-			}
-		} else if rLabel.MatchString(lineArr[0]) && !isMnemonic(lineArr[0]) { // Pseudo-ops
-			if pass == 1 {
-				if len(lineArr) > 1 && isMnemonic(lineArr[1]) { // pseudoop mnemonic, label
-					cur.mnemonic = strings.ToLower(lineArr[1])
-					cur.kind = "pse"
-					cur.isComment = true
-					if len(lineArr) != 3 {
-						errHandler(errs["parser"], "Pseudo-op is missing arguments.")
-					} else {
-						cur = parseAddress(rAddr.FindString(lineArr[2]), cur, symbols)
-						if cur.mnemonic == "equ" {
-							// load the equate label into the symbol table with the operand address
-							var tmp symbol
-							tmp.label = lineArr[0]
-							if symbolExists(tmp.label) {
-								errHandler(errs["duplicatesym"])
-							}
-							tmp.addHighByte = cur.opHighByte
-							tmp.addLowByte = cur.opLowByte
-							var tmpAddr = [2]byte{tmp.addHighByte, tmp.addLowByte}
-							tmp.intAddr = hexToInt(tmpAddr)
-							symbols = append(symbols, tmp)
-						}
-					}
-				} else {
-					errHandler(errs["mnemonic"], "Expected a pseudo-op.")
-				}
-			}
-		} else {
-			if isMnemonic(lineArr[0]) { // mnemonic, no label
-				cur.mnemonic = strings.ToLower(lineArr[0])
-				if len(lineArr) == 1 {
-					cur.kind = "zop"
-					cur.length = 1
-				}
+	if len(stmt.label) > maxLabelLength {
+		errHandler(errs["labelLength"])
+	} else if stmt.label != "" && !rLabel.MatchString(strings.TrimPrefix(stmt.label, "]")) {
+		errHandler(errs["mnemonic"], "(Is there an ill-formed label?)")
+		return cur
+	}
+	mnemonic := stmt.mnemonic
+	if mnemonic == "=" {
+		mnemonic = ".set"
+	}
+	if isVarName(stmt.label) && !strings.EqualFold(mnemonic, ".set") {
+		errHandler(errs["variable"], stmt.label+" is a variable; give it a value with = or .set.")
+		return cur
+	}
+	if stmt.mnemonic == "" {
+		switch {
+		case stmt.operand != "" || !stmt.colon && enumStart < 0:
+			if hint := mnemonicHint(stmt.label); hint != stmt.label { // perhaps a mistyped mnemonic
+				errHandler(errs["mnemonic"], "Expected a pseudo-op. "+hint)
 			} else {
-				errHandler(errs["mnemonic"], "(Is there an ill-formed label?)")
-			}
-			if len(lineArr) > 1 {
-				cur = parseOperand(lineArr[1], cur)
+				errHandler(errs["mnemonic"], "Expected a pseudo-op.")
 			}
+		case enumStart >= 0:
+			enumMember(stmt.label)
+		default: // label on its own
+			cur.label = stmt.label
+		}
+		return cur
+	}
+	if !isMnemonic(mnemonic) {
+		errHandler(errs["mnemonic"], mnemonicHint(mnemonic))
+		return cur
+	}
+	cur.mnemonic = strings.ToLower(mnemonic)
+	cur.label = stmt.label
+	if textDirectives[cur.mnemonic] { // arguments are evaluated once every address is known
+		cur.args = splitArgs(stmt.operand)
+		return cur
+	}
+	if _, ok := pseudoOps[cur.mnemonic]; !ok && stmt.label != "" && !stmt.colon {
+		errHandler(errs["mnemonic"], "Expected a pseudo-op. (Is the label missing its colon?)")
+		return cur
+	}
+	if cur.mnemonic == ".set" {
+		cur.label = ""
+		cur.kind = "pse"
+		parseSet(stmt.label, stmt.compact)
+		return cur
+	}
+	if cur.mnemonic == "equ" {
+		cur.label = ""
+		cur.kind = "pse"
+		if stmt.label == "" || stmt.compact == "" {
+			errHandler(errs["parser"], "Pseudo-op is missing arguments.")
+		} else if isExprOperand(stmt.arg.toks) {
+			defineEquate(stmt.label, stmt.arg.toks)
+		} else {
+			cur = parseAddress(rAddr.FindString(strings.ToLower(stmt.compact)), cur, symbols)
+			// load the equate label into the symbol table with the operand address
+			defineConstant(stmt.label, hexToInt([2]byte{cur.opHighByte, cur.opLowByte}))
 		}
+		return cur
+	}
+	cur.isComment = false
+	if stmt.compact == "" && (cur.mnemonic == ".align" || cur.mnemonic == ".phase" || cur.mnemonic == ".rorg") {
+		cur = parseArguments(stmt, cur) // reports the missing operand
+	} else if stmt.compact == "" {
+		cur.kind = "zop"
+		cur.length = 1
 	} else {
-		errHandler(errs["parser"], "Too many elements in line.")
+		cur = parseArguments(stmt, cur)
 	}
 	cur = assignOpcode(cur)
+	cur = parseBlock(cur)
+	cur = parseScope(cur)
+	cur = parsePhaseBlock(cur)
 	return cur
 }
 
-func parseOperand(op string, inst instruction) instruction {
-	op = strings.ToLower(op)
-	if rOperand.MatchString(op) && !symbolExists(op) { // is not a label
-		switch {
-		case rImm.MatchString(op):
-			inst.kind = "imm"
-			inst.length = 2
-		case rInd.MatchString(op):
-			inst.kind = "ind"
-			inst.length = 3
-		case rZp.MatchString(op):
-			inst.kind = "zp"
-			inst.length = 2
-		case rZpx.MatchString(op):
-			inst.kind = "zpx"
-			inst.length = 2
-		case rZpy.MatchString(op):
-			inst.kind = "zpy"
-			inst.length = 2
-		case rZpiy.MatchString(op):
-			inst.kind = "zpiy"
-			inst.length = 2
-		case rZpxi.MatchString(op):
-			inst.kind = "zpxi"
-			inst.length = 2
-		case rAbs.MatchString(op):
-			if _, ok := opRel[inst.mnemonic]; ok { // check if actually a relative instruction (branches)
-				inst.kind = "rel"
-				inst.length = 2
-			} else {
-				inst.kind = "abs"
-				inst.length = 3
-			}
-		case rAbsx.MatchString(op):
-			inst.kind = "absx"
-			inst.length = 3
-		case rAbsy.MatchString(op):
-			inst.kind = "absy"
-			inst.length = 3
-		default:
-			if len(op) > 4 {
-				errHandler(errs["parser"], "Operand/address is ill formed or does not match template.")
-			} else if !(len(op) == 2 || len(op) == 4) {
-				errHandler(errs["parser"], "Address is not 2 or 4 characters.")
-			} else {
-				errHandler(errs["parser"], "Does not match any operand template.")
+// Splits a line at its comment
+func splitComment(line string) (code string, comment string) {
+	code = lineCode(line)
+	return code, line[len(code):]
+}
+
+// Splits a source line into its label (with its colon, if any), mnemonic, operand and comment the
+// way parseLine reads them. ok is false if the line can't be read.
+func splitLine(line string) (label, mnemonic, operand, comment string, ok bool) {
+	stmt := parseStatement(line)
+	if stmt.err != "" {
+		return "", "", "", "", false
+	}
+	label = stmt.label
+	if stmt.colon {
+		label += ":"
+	}
+	return label, stmt.mnemonic, stmt.operand, stmt.comment, true
+}
+
+// Parses the operand field according to what the mnemonic expects
+func parseArguments(stmt statement, inst instruction) instruction {
+	op := stmt.compact
+	switch {
+	case inst.mnemonic == ".word":
+		return parseWords(op, inst)
+	case isData(inst.mnemonic):
+		return parseData(op, inst)
+	case inst.mnemonic == ".segment":
+		inst.args = []string{strings.Trim(op, `"`)}
+		return inst
+	case inst.mnemonic == ".align":
+		return parseAlign(op, inst)
+	case inst.mnemonic == ".charmap":
+		return parseCharmap(op, inst)
+	case inst.mnemonic == ".encoding":
+		return parseEncoding(op, inst)
+	case inst.mnemonic == ".res":
+		return parseRes(op, inst)
+	case inst.mnemonic == ".zp":
+		return parseZp(op, inst)
+	case inst.mnemonic == ".zparea":
+		return parseZpArea(op, inst)
+	case inst.mnemonic == ".enum" || inst.mnemonic == ".struct" || inst.mnemonic == ".proc" || inst.mnemonic == ".scope":
+		inst.args = []string{op}
+		return inst
+	case inst.mnemonic == ".rept" || inst.mnemonic == ".for":
+		inst.args = splitArgs(op)
+		return inst
+	case inst.mnemonic == ".phase" || inst.mnemonic == ".rorg":
+		return parsePhase(op, inst)
+	case inst.mnemonic == ".cycles":
+		inst.args = parseCycleTarget(op)
+		return inst
+	case inst.mnemonic == ".import" || inst.mnemonic == ".export":
+		inst.args = strings.Split(strings.ToLower(op), ",")
+		if inst.mnemonic == ".import" && pass == 1 {
+			declareImports(inst.args)
+		}
+		return inst
+	}
+	return parseOperand(stmt.arg, inst)
+}
+
+// Reads an operand. Plain hex operands, e.g. $fbe4, #$00 or ($10),y, take their addressing mode from
+// operandMode like any other, but the number of digits decides between zero page and absolute, so
+// $0010 stays absolute. Everything else goes to the expression parser.
+func parseOperand(arg operand, inst instruction) instruction {
+	if isExprOperand(arg.toks) || len(arg.expr) != 1 {
+		return parseExprOperand(arg, inst)
+	}
+	op, mode := arg.text(), arg.mode
+	digits := strings.TrimPrefix(strings.ToLower(arg.expr[0].text), "$")
+	if !rHex.MatchString(digits) || len(digits) < 2 {
+		return parseExprOperand(arg, inst)
+	}
+	wide := len(digits) == 4
+	_, isRel := opRel[inst.mnemonic]
+	inst.kind = ""
+	switch {
+	case len(digits) != 2 && !wide: // neither zero page nor absolute; reported below
+	case mode == "imm" && !wide:
+		inst.kind, inst.length = "imm", 2
+	case mode == "ind":
+		inst.kind, inst.length = "ind", 3
+	case mode == "" && !wide:
+		inst.kind, inst.length = "zp", 2
+	case mode == "" && isRel: // branches take an absolute target
+		inst.kind, inst.length = "rel", 2
+	case mode == "":
+		inst.kind, inst.length = "abs", 3
+	case mode == "x" && !wide:
+		inst.kind, inst.length = "zpx", 2
+	case mode == "x":
+		inst.kind, inst.length = "absx", 3
+	case mode == "y" && !wide:
+		inst.kind, inst.length = "zpy", 2
+	case mode == "y":
+		inst.kind, inst.length = "absy", 3
+	case mode == "zpxi" && (!wide || digits[:2] == "00"), mode == "zpiy" && !wide:
+		inst.kind, inst.length = mode, 2
+	}
+	if inst.kind == "" {
+		if len(op) > 4 {
+			errHandler(errs["parser"], "Operand/address is ill formed or does not match template.")
+		} else {
+			errHandler(errs["parser"], "Address is not 2 or 4 characters.")
+		}
+		return inst
+	}
+	inst = parseAddress(digits, inst, symbols)
+	return sizeBranch(inst)
+}
+
+// Parses the comma-separated byte list of a data pseudo-op. Items are 2-digit hex bytes or labels (low byte).
+func parseData(op string, inst instruction) instruction {
+	inst.kind = "dat"
+	inst.data = nil
+	inst.dataRefs = nil
+	pc := -1
+	if pass > 1 && curLine < len(passAddrs) {
+		pc = passAddrs[curLine]
+	}
+	for _, item := range splitArgs(op) {
+		if isTextLiteral(item) {
+			bytes, e := encodeText(item)
+			if e != nil {
+				errHandler(errs["encoding"], e.Error())
 			}
+			inst.data = append(inst.data, bytes...)
+			inst.dataRefs = append(inst.dataRefs, make([]dataRef, len(bytes))...)
+			continue
 		}
-		inst = parseAddress(rAddr.FindString(op), inst, symbols)
-	} else { // handle labels
-		switch {
-		// improvements needed: check if symbols known; if so, check addresses for ZP
-		// add handling of equates in indirect instructions
-		case rLabelOpAbs.MatchString(op):
-			if !symbolExists(op) && pass > 1 {
-				errHandler(errs["unknownsym"])
+		item = strings.ToLower(item)
+		if sym, ok := lookupScoped(item); ok {
+			addReference(sym.label, inst.mnemonic)
+			inst.data = append(inst.data, byte(sym.intAddr&0xff))
+			inst.dataRefs = append(inst.dataRefs, dataRef{sym.label, 0, relLow})
+			continue
+		}
+		isVar := isVariable(item)
+		if rZp.MatchString(item) && !isVar {
+			bytes, e := hex.DecodeString(strings.TrimPrefix(item, "$"))
+			if e != nil {
+				errHandler(errs["conversion"])
 			}
-			if _, ok := opRel[inst.mnemonic]; ok { // check if actually a relative instruction (branches)
-				inst.kind = "rel"
-				inst.length = 2
-			} else if strings.ToLower(op) == "a" && opZop[inst.mnemonic] > 0 { // check for ror a, rol a, similar
-				inst.kind = "zop"
-				inst.length = 1
-			} else {
-				inst.kind = "abs"
-				inst.length = 3
+			inst.data = append(inst.data, bytes[0])
+			inst.dataRefs = append(inst.dataRefs, dataRef{})
+		} else if rLabel.MatchString(item) && !isVar {
+			if pass > 1 {
+				errHandler(errs["unknownsym"], symbolHint(item))
 			}
-		case rLabelOpInd.MatchString(op):
-			if _, ok := opRel[inst.mnemonic]; ok { // check if actually a relative instruction (branches)
-				inst.kind = "rel"
-				inst.length = 2
-			} else {
-				inst.kind = "ind"
-				inst.length = 3
+			inst.data = append(inst.data, 0)
+			inst.dataRefs = append(inst.dataRefs, dataRef{})
+		} else { // an expression, e.g. <start or tbl+1
+			arg, e := valueOperand(item)
+			var val int
+			var refs, unknown []string
+			if e == nil {
+				val, refs, unknown, e = evalTokens(arg.toks, pc)
+			}
+			if e != nil || len(unknown) > 0 && pass > 1 {
+				errHandler(errs["operand"], "Data must be bytes, labels, strings, characters or expressions.")
+			} else if len(unknown) == 0 && (val < -128 || val > 0xff) {
+				errHandler(errs["operand"], fmt.Sprintf("%d ($%X) doesn't fit in a byte.", val, val))
+			}
+			for _, ref := range refs {
+				addReference(ref, inst.mnemonic)
 			}
+			inst.data = append(inst.data, byte(val))
+			inst.dataRefs = append(inst.dataRefs, dataReference(arg, refs, val, relLow))
 		}
-		found := rLabel.FindString(op)
-		if len(found) > 0 {
-			inst = parseAddress(found, inst, symbols)
-		} else {
-			errHandler(errs["label"])
+	}
+	inst.length = len(inst.data)
+	return inst
+}
+
+// Reads the values of .word, each stored low byte first. A word based on a label has its
+// reference against its low byte so buildObject can relocate the whole word.
+func parseWords(op string, inst instruction) instruction {
+	inst.kind = "dat"
+	inst.data = nil
+	inst.dataRefs = nil
+	pc := -1
+	if pass > 1 && curLine < len(passAddrs) {
+		pc = passAddrs[curLine]
+	}
+	for _, item := range splitArgs(op) {
+		arg, e := valueOperand(item)
+		var val int
+		var refs, unknown []string
+		if e == nil {
+			val, refs, unknown, e = evalTokens(arg.toks, pc)
 		}
+		if e != nil || len(unknown) > 0 && pass > 1 {
+			errHandler(errs["operand"], "Words must be labels or expressions.")
+		} else if len(unknown) == 0 && (val < -0x8000 || val > 0xffff) {
+			errHandler(errs["operand"], fmt.Sprintf("%d ($%X) doesn't fit in a word.", val, val))
+		}
+		for _, ref := range refs {
+			addReference(ref, inst.mnemonic)
+		}
+		inst.data = append(inst.data, byte(val), byte(val>>8))
+		inst.dataRefs = append(inst.dataRefs, dataReference(arg, refs, val, relWord), dataRef{})
 	}
+	inst.length = len(inst.data)
 	return inst
 }
 
 func parseAddress(addr string, inst instruction, symbols []symbol) instruction {
-	if rAddr.MatchString(addr) && !symbolExists(addr) { // if it looks like an address and is not a known symbol
+	if rAddr.MatchString(addr) && !scopedSymbolExists(addr) && !isLabelOperand(addr) { // if it looks like an address and is not a known symbol
 		bytes, e := hex.DecodeString(addr)
 		if e != nil {
 			errHandler(errs["conversion"])
@@ -339,7 +617,7 @@ func parseAddress(addr string, inst instruction, symbols []symbol) instruction {
 		for _, symbol := range symbols {
 			if symbol.label == addr { // symbol is known from previous pass
 				bytes := intToHex(symbol.intAddr)
-				if len(addr)/2 != inst.length-1 && inst.kind != "rel" && inst.kind != "pse" {
+				if len(bytes) > inst.length-1 && inst.kind != "rel" && inst.kind != "pse" {
 					errHandler(errs["length"], "Expected "+strconv.Itoa(inst.length-1)+" bytes for "+inst.mnemonic+".")
 				} else {
 					if len(bytes) > 1 {
@@ -361,8 +639,10 @@ func assignOpcode(inst instruction) instruction {
 	if !inst.isComment && inst.mnemonic != "" {
 		_, ok := pseudoOps[inst.mnemonic]
 		if ok {
-			inst.kind = "pse"
-			inst.isComment = true // set pseudo-ops to comments
+			if inst.kind != "dat" { // data pseudo-ops keep their bytes
+				inst.kind = "pse"
+				inst.isComment = true // set pseudo-ops to comments
+			}
 		} else {
 			switch inst.kind {
 			case "zop":
@@ -370,87 +650,87 @@ func assignOpcode(inst instruction) instruction {
 				if ok {
 					inst.opcode = opZop[inst.mnemonic]
 				} else {
-					errHandler(errs["opcode"], "Not a zero-operand instruction.")
+					errHandler(errs["opcode"], "Not a zero-operand instruction."+" "+modeHint(inst.mnemonic))
 				}
 			case "imm":
 				_, ok = opImm[inst.mnemonic]
 				if ok {
 					inst.opcode = opImm[inst.mnemonic]
 				} else {
-					errHandler(errs["opcode"], "Not an immediate instruction.")
+					errHandler(errs["opcode"], "Not an immediate instruction."+" "+modeHint(inst.mnemonic))
 				}
 			case "zp":
 				_, ok = opZp[inst.mnemonic]
 				if ok {
 					inst.opcode = opZp[inst.mnemonic]
 				} else {
-					errHandler(errs["opcode"], "Not a zero-page instruction.")
+					errHandler(errs["opcode"], "Not a zero-page instruction."+" "+modeHint(inst.mnemonic))
 				}
 			case "zpx":
 				_, ok = opZpx[inst.mnemonic]
 				if ok {
 					inst.opcode = opZpx[inst.mnemonic]
 				} else {
-					errHandler(errs["opcode"], "Not a zero-page,X instruction.")
+					errHandler(errs["opcode"], "Not a zero-page,X instruction."+" "+modeHint(inst.mnemonic))
 				}
 			case "zpy":
 				_, ok = opZpy[inst.mnemonic]
 				if ok {
 					inst.opcode = opZpy[inst.mnemonic]
 				} else {
-					errHandler(errs["opcode"], "Not a zero-page,Y instruction.")
+					errHandler(errs["opcode"], "Not a zero-page,Y instruction."+" "+modeHint(inst.mnemonic))
 				}
 			case "abs":
 				_, ok = opAbs[inst.mnemonic]
 				if ok {
 					inst.opcode = opAbs[inst.mnemonic]
 				} else {
-					errHandler(errs["opcode"], "Not an absolute instruction.")
+					errHandler(errs["opcode"], "Not an absolute instruction."+" "+modeHint(inst.mnemonic))
 				}
 			case "absx":
 				_, ok = opAbsx[inst.mnemonic]
 				if ok {
 					inst.opcode = opAbsx[inst.mnemonic]
 				} else {
-					errHandler(errs["opcode"], "Not an absolute,X instruction.")
+					errHandler(errs["opcode"], "Not an absolute,X instruction."+" "+modeHint(inst.mnemonic))
 				}
 			case "absy":
 				_, ok = opAbsy[inst.mnemonic]
 				if ok {
 					inst.opcode = opAbsy[inst.mnemonic]
 				} else {
-					errHandler(errs["opcode"], "Not an absolute,y instruction.")
+					errHandler(errs["opcode"], "Not an absolute,y instruction."+" "+modeHint(inst.mnemonic))
 				}
 			case "zpxi":
 				_, ok = opZpxi[inst.mnemonic]
 				if ok {
 					inst.opcode = opZpxi[inst.mnemonic]
 				} else {
-					errHandler(errs["opcode"], "Not an indexed indirect instruction.")
+					errHandler(errs["opcode"], "Not an indexed indirect instruction."+" "+modeHint(inst.mnemonic))
 				}
 			case "zpiy":
 				_, ok = opZpiy[inst.mnemonic]
 				if ok {
 					inst.opcode = opZpiy[inst.mnemonic]
 				} else {
-					errHandler(errs["opcode"], "Not an indirect indexed instruction.")
+					errHandler(errs["opcode"], "Not an indirect indexed instruction."+" "+modeHint(inst.mnemonic))
 				}
 			case "ind":
 				_, ok = opInd[inst.mnemonic]
 				if ok {
 					inst.opcode = opInd[inst.mnemonic]
 				} else {
-					errHandler(errs["opcode"], "Not an indirect instruction.")
+					errHandler(errs["opcode"], "Not an indirect instruction."+" "+modeHint(inst.mnemonic))
 				}
-			case "rel":
+			case "rel", "far":
 				_, ok = opRel[inst.mnemonic]
 				if ok {
 					inst.opcode = opRel[inst.mnemonic]
 				} else {
-					errHandler(errs["opcode"], "Not a relative instruction.")
+					errHandler(errs["opcode"], "Not a relative instruction."+" "+modeHint(inst.mnemonic))
 				}
 			default:
-				errHandler(errs["opcode"])
+				errHandler(errs["opcode"], modeHint(inst.mnemonic))
 			}
 		}
 	}
@@ -458,45 +738,47 @@ func assignOpcode(inst instruction) instruction {
 }
 
 func asmObject(insts []instruction) (obj [][]byte) {
-	var PC int = org
+	var PC int
+	segs := lineSegments(insts)
+	pcs := map[string]int{}
 	for i, inst := range insts {
+		if _, ok := pcs[segs[i]]; !ok {
+			pcs[segs[i]] = segBase[segs[i]]
+		}
+		PC = pcs[segs[i]]
 		if PC > 0xffff {
 			errHandler(errs["space"], "Set org to lower starting address.")
 		}
 		var tmp []byte
 		curLine = i
+		lineAddrs = append(lineAddrs, PC)
+		run := PC + runOffset(i) // differs from PC in a .phase block
 		if !inst.isComment {
-			if inst.kind == "rel" { // handle relative addressing
-				tmp = append(tmp, inst.opcode)
-				var tmpAddr = [2]byte{inst.opHighByte, inst.opLowByte}
-				var intTmpAddr = hexToInt(tmpAddr)
-				if intTmpAddr > PC { // relative branch is positive
-					diff := intTmpAddr - (PC + 2)
-					if diff > 127 {
-						errHandler(errs["relative"], "Positive offset greater than 127.")
-					} else {
-						if diff <= 255 {
-							tmp = append(tmp, intToHex(diff)[0]) // low byte
-						} else {
-							tmp = append(tmp, intToHex(diff)[1]) // low byte
-						}
-						PC += 2
-					}
-				} else { // relative branch is negative
-					testPrint(inst)
-					diff := (PC + 1) - intTmpAddr
-					diff = 255 - diff
-					if diff < 127 {
-						errHandler(errs["relative"], "Negative offset greater than -128.")
-					} else {
-						if diff <= 255 {
-							tmp = append(tmp, intToHex(diff)[0]) // low byte
-						} else {
-							tmp = append(tmp, intToHex(diff)[1]) // low byte
-						}
-						PC += 2
-					}
+			if inst.mnemonic == ".align" {
+				tmp = alignBytes(inst, run, isBss(segs[i]))
+				PC += alignPadding(inst, run)
+			} else if inst.mnemonic == ".res" {
+				if !isBss(segs[i]) {
+					tmp = append(tmp, inst.data...)
+				}
+				PC += inst.length
+			} else if inst.kind == "dat" {
+				tmp = append(tmp, inst.data...)
+				PC += len(inst.data)
+			} else if inst.kind == "rel" { // handle relative addressing
+				var target = hexToInt([2]byte{inst.opHighByte, inst.opLowByte})
+				disp := target - (run + 2) // signed displacement from the next instruction
+				if disp < -128 || disp > 127 {
+					errHandler(errs["relative"], branchDistance(disp))
+					disp = 0
 				}
+				tmp = append(tmp, inst.opcode, byte(disp))
+				PC += 2
+			} else if inst.kind == "far" { // out of range branch, inverted over a jmp
+				var target = hexToInt([2]byte{inst.opHighByte, inst.opLowByte})
+				warnHandler(errs["farbranch"], branchDistance(target-(run+2))+" Assembled as "+invertBranch[inst.mnemonic]+" *+5 and jmp.")
+				tmp = append(tmp, opRel[invertBranch[inst.mnemonic]], 3, opAbs["jmp"], inst.opLowByte, inst.opHighByte)
+				PC += 5
 			} else {
 				tmp = append(tmp, inst.opcode)
 				PC++
@@ -510,14 +792,52 @@ func asmObject(insts []instruction) (obj [][]byte) {
 				}
 			}
 		}
+		if len(tmp) > 0 && isBss(segs[i]) {
+			errHandler(errs["bss"], "Segment "+segs[i]+" only reserves space.")
+		}
+		pcs[segs[i]] = PC
 		obj = append(obj, tmp)
 	}
 	return obj
 }
 
+// Describes how far a branch has to reach and by how much that is out of range
+func branchDistance(disp int) string {
+	if disp >= 0 {
+		return fmt.Sprintf("Target is %d bytes ahead; branches reach 127 (%d too far).", disp, disp-127)
+	}
+	return fmt.Sprintf("Target is %d bytes back; branches reach 128 (%d too far).", -disp, -disp-128)
+}
+
+// Makes a branch that was out of range in the last pass into an inverted branch over a jmp when
+// -far-branches is on. A branch stays long once promoted so the passes settle.
+func sizeBranch(inst instruction) instruction {
+	if !farBranches || inst.kind != "rel" {
+		return inst
+	}
+	if !farLines[curLine] && pass > 1 && curLine < len(passAddrs) && (inst.symRef == "" || symbolExists(inst.symRef)) {
+		disp := hexToInt([2]byte{inst.opHighByte, inst.opLowByte}) - (passAddrs[curLine] + 2)
+		if disp < -128 || disp > 127 {
+			farLines[curLine] = true
+		}
+	}
+	if farLines[curLine] {
+		inst.kind = "far"
+		inst.length = 5
+	}
+	return inst
+}
+
 func getOrg(insts []instruction) {
-	for _, inst := range insts {
+	for i, inst := range insts {
 		if inst.mnemonic == "org" {
+			if relocatable {
+				curLine = i
+				errHandler(errs["reloc"], "The linker's memory map places relocatable code.")
+			} else if mapFilename != "" {
+				curLine = i
+				errHandler(errs["org"], "The memory map places the segments; org cannot be used with -map.")
+			}
 			var addr = [2]byte{inst.opHighByte, inst.opLowByte}
 			org = hexToInt(addr)
 			break
@@ -525,13 +845,44 @@ func getOrg(insts []instruction) {
 	}
 }
 
-func getSymbols(insts []instruction) {
-	var PC int = org
+// Assigns addresses to the labels. A label already in the table from an earlier pass is updated in
+// place; those whose address changed are returned, with their previous address in intAddr.
+func getSymbols(insts []instruction) (changed []symbol) {
+	segs := lineSegments(insts)
+	offsets := make([]int, len(insts))
+	sizes := map[string]int{}
+	segNames = nil
+	for i, inst := range insts { // size each segment before placing them
+		if _, ok := sizes[segs[i]]; !ok {
+			segNames = append(segNames, segs[i])
+			sizes[segs[i]] = 0
+		}
+		offsets[i] = sizes[segs[i]]
+		if inst.mnemonic == ".align" { // pad from where the last pass placed the line
+			insts[i].length = alignPadding(inst, segBase[segs[i]]+offsets[i]+runOffset(i))
+			inst.length = insts[i].length
+		}
+		if !inst.isComment && inst.kind != "pse" {
+			sizes[segs[i]] += inst.length
+		}
+	}
+	layoutSegments(sizes)
+	loads := make([]int, len(insts))
+	for i := range insts {
+		loads[i] = segBase[segs[i]] + offsets[i]
+	}
+	runOffsets = phaseOffsets(insts, loads)
+	passAddrs = make([]int, len(insts))
 	for i, inst := range insts {
 		curLine = i
+		PC := loads[i] + runOffsets[i]
+		passAddrs[i] = PC
 		if inst.label != "" && inst.kind != "pse" {
 			var tmp symbol
-			tmp.label = inst.label
+			tmp.label = lineScopes[i] + inst.label
+			tmp.defLine = i
+			tmp.kind = "lbl"
+			tmp.segment = segs[i]
 			tmp.intAddr = PC
 			tmpAddr := intToHex(tmp.intAddr)
 			if tmp.intAddr <= 255 {
@@ -540,81 +891,38 @@ func getSymbols(insts []instruction) {
 				tmp.addHighByte = tmpAddr[0]
 				tmp.addLowByte = tmpAddr[1]
 			}
-			if symbolExists(tmp.label) {
-				errHandler(errs["duplicatesym"])
-			} else {
+			if _, ok := varLines[tmp.label]; ok {
+				errHandler(errs["duplicatesym"], tmp.label+" is a variable.")
+			} else if n := symbolIndex(tmp.label); n < 0 {
 				symbols = append(symbols, tmp)
+			} else if symbols[n].kind != "lbl" || symbols[n].defLine != i {
+				errHandler(errs["duplicatesym"])
+			} else if symbols[n].intAddr != tmp.intAddr {
+				changed = append(changed, symbols[n])
+				symbols[n] = tmp
 			}
 		}
-		if !inst.isComment && inst.kind != "pse" {
-			PC += inst.length
-		}
 	}
+	return
 }
 
-func logAssembly(lines []string, obj [][]byte) {
-	// addr | sym | ops | line | file
-	// 5	  7	    10    7      no limit
-	var symi int = 0
-	var PC int = org
-	var PCStart int = PC
-	log += setStringToWidth("\nAssembly Listing ", 75, "=") + "\n"
-	for i, line := range obj {
-		if len(line) > 0 {
-			log += setStringToWidth(fmt.Sprintf("%04X", PC), 5)
-			// PC += len(line)
-		} else {
-			log += setStringToWidth("", 5)
-		}
-		if len(symbols) > 0 && symbols[symi].intAddr == PC && len(line) > 0 {
-			log += setStringToWidth(symbols[symi].label, 7)
-			if len(symbols)-1 > symi {
-				symi++
-			}
-		} else {
-			log += setStringToWidth("", 7)
-		}
-		var tmp string
-		for _, op := range line {
-			tmp += fmt.Sprintf("%02X ", op)
-		}
-		log += setStringToWidth(tmp, 10)
-		log += "| "
-		log += setStringToWidth(strconv.Itoa(i+1), 7)
-		log += lines[i] + "\n"
-		if len(line) > 0 {
-			PC += len(line)
+// Lists labels that moved between passes and where they went
+func describeChanges(changed []symbol) (str string) {
+	for i, sym := range changed {
+		if i > 0 {
+			str += ", "
 		}
+		now, _ := lookupSymbol(sym.label)
+		str += fmt.Sprintf("%s ($%04X -> $%04X)", sym.label, sym.intAddr, now.intAddr)
 	}
-	log += fmt.Sprintf("\nObject will fill from $%04X through $%04X. ($%04X bytes)\n", PCStart, PC-1, PC-PCStart)
+	return
 }
 
 func logSymbolTable() {
-	if len(symbols) != 0 {
-		var colWidth int = 60
-		var runWidth int = 0
+	if len(symbols) != 0 || len(varLines) != 0 {
 		log += setStringToWidth("\nSymbol Table ", 75, "=") + "\n"
-		var tmp []string
-		for _, symbol := range symbols {
-			tmp = append(tmp, symbol.label)
-		}
-		sort.Strings(tmp)
-		for _, ssymbol := range tmp {
-			for _, symbol := range symbols {
-				if symbol.label == ssymbol {
-					if runWidth > colWidth {
-						log += "\n"
-						runWidth = 0
-					}
-					tmp := setStringToWidth(symbol.label, 8)
-					runWidth += len(tmp)
-					log += tmp
-					tmp = setStringToWidth(fmt.Sprintf("$%04X", symbol.intAddr), 12)
-					runWidth += len(tmp)
-					log += tmp
-				}
-			}
-		}
+		logScope("", 0)
+		logVariables()
 	}
 }
 
@@ -670,6 +978,34 @@ func intToHex(addr int) []byte {
 	return tmp
 }
 
+// A bare word is a label, even before it is defined, unless it is made entirely of hex digits
+func isLabelOperand(op string) bool {
+	word := strings.Trim(op, "()")
+	return rLabel.MatchString(word) && !rHex.MatchString(word)
+}
+
+func isData(mnemonic string) bool {
+	return mnemonic == "dfb" || mnemonic == ".word"
+}
+
+func lookupSymbol(sym string) (symbol, bool) {
+	for _, symbol := range symbols {
+		if sym == symbol.label {
+			return symbol, true
+		}
+	}
+	return symbol{}, false
+}
+
+func symbolIndex(sym string) int {
+	for i, symbol := range symbols {
+		if sym == symbol.label {
+			return i
+		}
+	}
+	return -1
+}
+
 func symbolExists(sym string) bool {
 	for _, symbol := range symbols {
 		if sym == symbol.label {
@@ -693,42 +1029,114 @@ func setStringToWidth(str string, wid int, filler ...string) (outstr string) {
 }
 
 func errHandler(err []string, deets ...string) {
-	color.FgRed.Print("\nERROR ")
-	if len(lines) == 0 || err[0] == "File I/O" {
+	if collectDiagnostics {
+		addDiagnostic(1, err, deets...)
+		return
+	}
+	if !alreadyReported(err, deets...) {
+		color.FgRed.Print("\nERROR " + err[2] + " ")
+		printContext(err, deets...)
+		errorCount++
+	}
+	if !continueOnError {
+		os.Exit(1)
+	}
+}
+
+// Reports a problem that doesn't stop the assembly
+func warnHandler(err []string, deets ...string) {
+	if collectDiagnostics {
+		addDiagnostic(2, err, deets...)
+		return
+	}
+	if !alreadyReported(err, deets...) {
+		color.FgYellow.Print("\nWARNING " + err[2] + " ")
+		printContext(err, deets...)
+	}
+}
+
+// Whether the same diagnostic was printed for the line before, e.g. by an earlier pass. Problems
+// that aren't tied to a line are told apart by their details.
+func alreadyReported(err []string, deets ...string) bool {
+	key := err[2] + " " + strconv.Itoa(sourceLine(curLine))
+	if len(lines) == 0 || isGeneral(err) {
+		key = err[2] + " " + strings.Join(deets, " ")
+	}
+	if reported[key] {
+		return true
+	}
+	reported[key] = true
+	return false
+}
+
+// Whether a diagnostic is about the whole build rather than a source line
+func isGeneral(err []string) bool {
+	return err[0] == "File I/O" || err[0] == "Linker" || err[0] == "Memory map" || err[0] == "Output format"
+}
+
+// Prints the line a diagnostic refers to, then its message and details
+func printContext(err []string, deets ...string) {
+	if len(lines) == 0 || isGeneral(err) {
 		color.FgDefault.Println("[general]")
 	} else {
-		color.FgDefault.Print("[line " + strconv.Itoa(curLine+1) + "] ")
-		fmt.Println(strings.Split(strings.Split(strings.TrimSpace(lines[curLine]), "*")[0], ";")[0])
+		color.FgDefault.Print("[line " + strconv.Itoa(sourceLine(curLine)+1) + "] ")
+		code, _ := splitComment(strings.TrimSpace(lines[sourceLine(curLine)]))
+		fmt.Println(code)
 	}
 	fmt.Println(err[1])
 	if len(deets) > 0 {
 		fmt.Println(deets[0])
 	}
-	if !continueOnError {
-		os.Exit(1)
-	}
 }
 
-// For error handling
+// For error handling: category, message and the code printed with it (see explain.go)
 var errs = map[string][]string{
-	"conversion":   {"Hex to byte", "Could not complete conversion."},
-	"duplicatesym": {"Duplicate symbol", "The label already exists in the symbol table."},
-	"file":         {"File I/O", "Could not read or write to file."},
-	"label":        {"Label", "Operand too short or cannot parse label."},
-	"labelLength":  {"Label", "Label must not exceed " + strconv.Itoa(maxLabelLength) + " chars."},
-	"length":       {"Address length", "Address length does not match opcode."},
-	"mnemonic":     {"Mnemonic", "Could not find a valid mnemonic."},
-	"nofile":       {"File I/O", "No file specified."},
-	"opcode":       {"Opcode", "Invalid mnemonic/operand combination."},
-	"operand":      {"Operand", "The operand is ill formed."},
-	"org":          {"Org", "Pseudo-op address could not be determined."},
-	"parser":       {"Parser", "Could not parse line successfully."},
-	"relative":     {"Branching", "Relative address is out of range."},
-	"space":        {"Memory", "Object will not fit in address space."},
-	"symbol":       {"Symbol", "Could not determine symbol address."},
-	"textfile":     {"File I/O", "Could not write to text file."},
-	"toomanyargs":  {"Arguments", "Too many arguments on command line"},
-	"unknownsym":   {"Symbol", "Symbol not defined."}}
+	"align":        {"Alignment", "Could not read the alignment.", "E0001"},
+	"alloc":        {"Allocation", "Could not allocate the variable.", "E0002"},
+	"assert":       {"Assertion", "Assertion failed.", "E0003"},
+	"bank":         {"Bank", "Code calls into another bank directly.", "E0004"},
+	"block":        {"Block", "Struct or enum block is not well formed.", "E0005"},
+	"bss":          {"Segment", "Code or data cannot be placed in an uninitialized segment.", "E0006"},
+	"conversion":   {"Hex to byte", "Could not complete conversion.", "E0007"},
+	"cycles":       {"Timing", "Cycle count is not what was expected.", "E0008"},
+	"duplicatesym": {"Duplicate symbol", "The label already exists in the symbol table.", "E0009"},
+	"farbranch":    {"Branching", "Branch target is out of range.", "E0010"},
+	"file":         {"File I/O", "Could not read or write to file.", "E0011"},
+	"encoding":     {"Encoding", "Could not encode the text.", "E0012"},
+	"expression":   {"Expression", "Could not evaluate expression.", "E0013"},
+	"fmtcase":      {"Arguments", "Case must be lower, upper or keep.", "E0014"},
+	"fmtcols":      {"Arguments", "Format columns must be three positions, e.g. 8,12,24.", "E0015"},
+	"format":       {"Output format", "Cannot write the output format.", "E0016"},
+	"label":        {"Label", "Operand too short or cannot parse label.", "E0017"},
+	"labelLength":  {"Label", "Label must not exceed " + strconv.Itoa(maxLabelLength) + " chars.", "E0018"},
+	"length":       {"Address length", "Address length does not match opcode.", "E0019"},
+	"link":         {"Linker", "Could not link objects.", "E0020"},
+	"listcols":     {"Arguments", "Listing columns must be four positive widths, e.g. 5,7,10,7.", "E0021"},
+	"loop":         {"Loop", "Repeated block is not well formed.", "E0022"},
+	"memmap":       {"Memory map", "Could not parse memory map configuration.", "E0023"},
+	"mnemonic":     {"Mnemonic", "Could not find a valid mnemonic.", "E0024"},
+	"nofile":       {"File I/O", "No file specified.", "E0025"},
+	"object":       {"File I/O", "Could not read relocatable object file.", "E0026"},
+	"opcode":       {"Opcode", "Invalid mnemonic/operand combination.", "E0027"},
+	"operand":      {"Operand", "The operand is ill formed.", "E0028"},
+	"overflow":     {"Memory map", "Segment does not fit in its region.", "E0029"},
+	"org":          {"Org", "Pseudo-op address could not be determined.", "E0030"},
+	"page":         {"Alignment", "Code or data crosses a page boundary.", "E0031"},
+	"parser":       {"Parser", "Could not parse line successfully.", "E0032"},
+	"phase":        {"Phase", "Label addresses did not settle between passes.", "E0033"},
+	"phaseblock":   {"Phase", "Phased block is not well formed.", "E0034"},
+	"relative":     {"Branching", "Relative address is out of range.", "E0035"},
+	"segment":      {"Segment", "Segment is not in the memory map.", "E0036"},
+	"reloc":        {"Relocation", "Not allowed in a relocatable object.", "E0037"},
+	"scope":        {"Scope", "Proc or scope block is not well formed.", "E0038"},
+	"space":        {"Memory", "Object will not fit in address space.", "E0039"},
+	"textfile":     {"File I/O", "Could not write to text file.", "E0041"},
+	"toomanyargs":  {"Arguments", "Too many arguments on command line", "E0042"},
+	"unknownsym":   {"Symbol", "Symbol not defined.", "E0043"},
+	"unresolved":   {"Linker", "Imported symbol is not exported by any object.", "E0044"},
+	"usererror":    {"Source", "Error raised by .error.", "E0045"},
+	"userwarning":  {"Source", "Warning raised by .warning.", "E0046"},
+	"variable":     {"Variable", "Could not set the variable.", "E0047"}}
 
 func removePathFileExtension(path string) (newpath string) {
 	slash_chk := strings.Split(path, "/")
@@ -747,19 +1155,3 @@ func removePathFileExtension(path string) (newpath string) {
 	}
 	return
 }
-
-func testPrint(inst instruction) {
-	fmt.Println("Instruction")
-	fmt.Println(strings.Repeat("=", 20))
-	if inst.isComment && inst.kind != "pse" {
-		fmt.Println("Comment line")
-	} else {
-		fmt.Println("Mnemonic: " + inst.mnemonic)
-		fmt.Println("Kind:     " + inst.kind)
-		fmt.Printf("Length    %x\n", inst.length)
-		fmt.Printf("Opcode:   %x\n", inst.opcode)
-		fmt.Printf("Add HB    %x\n", inst.opHighByte)
-		fmt.Printf("Add LB    %x\n", inst.opLowByte)
-		fmt.Println("Label:    " + inst.label)
-	}
-}
@@ -0,0 +1,218 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> main_test.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gookit/color"
+)
+
+// Assembles src the way the language server does, collecting diagnostics instead of printing
+// them and stopping at the first error
+func testAssemble(t *testing.T, src string) (insts []instruction, obj [][]byte) {
+	t.Helper()
+	collectDiagnostics = true
+	defer func() {
+		collectDiagnostics = false
+		if r := recover(); r != nil {
+			t.Fatalf("assembly stopped: %v", r)
+		}
+	}()
+	return assemble(splitSource(src))
+}
+
+// Sends what the test prints to the null device
+func quiet(t *testing.T) {
+	t.Helper()
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = null
+	color.SetOutput(null)
+	t.Cleanup(func() {
+		os.Stdout = stdout
+		color.ResetOutput()
+		null.Close()
+	})
+}
+
+// Makes the next assemblies use a memory map with the given configuration
+func useMemoryMap(t *testing.T, cfg string) {
+	t.Helper()
+	mapFilename = filepath.Join(t.TempDir(), "test.cfg")
+	t.Cleanup(func() { mapFilename = "" })
+	if err := ioutil.WriteFile(mapFilename, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Whether the last assembly reported the error code, e.g. E0001
+func hasDiagnostic(code string) bool {
+	for _, d := range diagnostics {
+		if d.code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// The object code of every line, in order
+func flatBytes(obj [][]byte) (out []byte) {
+	for _, line := range obj {
+		out = append(out, line...)
+	}
+	return
+}
+
+func expectBytes(t *testing.T, got []byte, want string) {
+	t.Helper()
+	if fmt.Sprintf("% x", got) != want {
+		t.Errorf("got bytes % x, want %s", got, want)
+	}
+}
+
+func TestErrorsReportedOncePerLine(t *testing.T) {
+	quiet(t)
+	continueOnError = true
+	defer func() { continueOnError = false }()
+	assemble(splitSource(`        org $0800
+        sty $1234,y
+        lad #$00
+        nop
+`))
+	if errorCount != 2 {
+		t.Errorf("reported %d errors, want 2", errorCount)
+	}
+}
+
+// A forward reference is sized as absolute until a later pass finds it in zero page, which moves
+// the labels after it, so it takes more than one extra pass to settle
+func TestForwardReferencesSettle(t *testing.T) {
+	_, obj := testAssemble(t, `        org $0000
+        lda data
+        ldx more
+data:   dfb $01
+more:   dfb $02
+`)
+	if len(diagnostics) > 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	expectBytes(t, flatBytes(obj), "a5 04 a6 05 01 02")
+	if pass < 3 {
+		t.Errorf("settled after %d passes, want at least 3", pass)
+	}
+}
+
+// An operand that fits in zero page only when sized as absolute never settles
+func TestPassesGiveUp(t *testing.T) {
+	testAssemble(t, `        org $0010
+        lda $0112-tgt
+tgt:    nop
+`)
+	if !hasDiagnostic(errs["phase"][2]) {
+		t.Fatalf("expected %s, got %v", errs["phase"][2], diagnostics)
+	}
+	if pass != maxPasses {
+		t.Errorf("gave up after %d passes, want %d", pass, maxPasses)
+	}
+	if d := diagnostics[0]; d.line != 2 || !strings.Contains(d.message, "tgt ($0013 -> $0012)") {
+		t.Errorf("got diagnostic %+v", d)
+	}
+}
+
+// Branches reach 127 bytes ahead and 128 back from the next instruction
+func TestBranchRange(t *testing.T) {
+	for _, test := range []struct {
+		pad  int
+		back bool
+		want string // message if out of range
+	}{
+		{127, false, ""},
+		{128, false, "Target is 128 bytes ahead; branches reach 127 (1 too far)."},
+		{125, true, ""},
+		{126, true, "Target is 129 bytes back; branches reach 128 (1 too far)."},
+	} {
+		src := fmt.Sprintf("        org $0800\n        beq fwd\n        .res %d\nfwd:    nop\n", test.pad)
+		if test.back {
+			src = fmt.Sprintf("        org $0800\nback:   nop\n        .res %d\n        bne back\n", test.pad)
+		}
+		_, obj := testAssemble(t, src)
+		switch {
+		case test.want == "" && len(diagnostics) > 0:
+			t.Errorf("%d bytes between: unexpected diagnostics %v", test.pad, diagnostics)
+		case test.want != "" && (len(diagnostics) != 1 || !strings.HasSuffix(diagnostics[0].message, test.want)):
+			t.Errorf("%d bytes between: got %v, want %q", test.pad, diagnostics, test.want)
+		case test.want == "" && test.back:
+			expectBytes(t, obj[3], "d0 80")
+		case test.want == "":
+			expectBytes(t, obj[1], "f0 7f")
+		}
+	}
+}
+
+// With -far-branches, a branch out of range becomes the opposite branch over a jmp, with a warning
+func TestFarBranch(t *testing.T) {
+	farBranches = true
+	defer func() { farBranches = false }()
+	_, obj := testAssemble(t, `        org $0800
+        bcc fwd
+        .res 200
+fwd:    bne fwd
+`)
+	if len(diagnostics) != 1 || diagnostics[0].code != errs["farbranch"][2] || diagnostics[0].severity != 2 {
+		t.Fatalf("got diagnostics %v, want one warning %s", diagnostics, errs["farbranch"][2])
+	}
+	expectBytes(t, obj[1], "b0 03 4c cd 08")
+	expectBytes(t, obj[3], "d0 fe")
+}
+
+// * in a data expression is the address of the line. Until a pass has placed the line, the value
+// isn't range checked.
+func TestDataExpressionsUsePC(t *testing.T) {
+	_, obj := testAssemble(t, `        org $0812
+        nop
+        dfb <*, >*, *-$0800
+        .word *, *-$8800
+`)
+	if len(diagnostics) > 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	expectBytes(t, flatBytes(obj), "ea 13 08 13 16 08 16 80")
+}
@@ -0,0 +1,201 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> memmap.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// Memory map configuration, one declaration per line; ; and * start comments as in source files
+//
+//	region  RAM      start=$0800 size=$9000 fill=$00
+//	region  ZP       start=$0080 size=$0080
+//	region  BANK1    start=$8000 size=$2000 bank=1
+//	segment CODE     region=RAM align=$0100
+//	segment BSS      region=RAM bss
+//	segment ZEROPAGE region=ZP bss
+//
+// Segments are placed in their region in the order they are declared. A region with a fill
+// value is padded to its full size in the output image. Regions in different banks can share
+// addresses; see banks.go.
+
+type region struct {
+	name  string
+	start int
+	size  int
+	fill  int // -1 if the region is not padded
+	bank  int // -1 if the region is not banked
+	used  int // bytes placed so far
+}
+
+type segmentMap struct {
+	name   string
+	region string
+	align  int
+	bss    bool
+}
+
+type memoryMap struct {
+	filename string
+	regions  []region
+	segments []segmentMap
+}
+
+func loadMemoryMap(filename string) (mm memoryMap) {
+	file, e := ioutil.ReadFile(filename)
+	if e != nil {
+		errHandler(errs["file"], filename)
+		return
+	}
+	mm.filename = filename
+	for i, line := range strings.Split(string(file), "\n") {
+		where := filename + " line " + strconv.Itoa(i+1) + ": "
+		for _, char := range comchars {
+			line = strings.Split(line, string(char))[0]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			errHandler(errs["memmap"], where+"Expected a name after "+fields[0]+".")
+			continue
+		}
+		opts := map[string]string{}
+		for _, field := range fields[2:] {
+			kv := strings.SplitN(strings.ToLower(field), "=", 2)
+			if len(kv) == 1 {
+				kv = append(kv, "")
+			}
+			opts[kv[0]] = kv[1]
+		}
+		switch strings.ToLower(fields[0]) {
+		case "region":
+			r := region{name: fields[1], fill: -1, bank: -1}
+			r.start = mapNumber(opts["start"], where+"region start")
+			r.size = mapNumber(opts["size"], where+"region size")
+			if _, ok := opts["fill"]; ok {
+				r.fill = mapNumber(opts["fill"], where+"fill value") & 0xff
+			}
+			if _, ok := opts["bank"]; ok {
+				if r.bank = mapNumber(opts["bank"], where+"bank"); r.bank > 0xff {
+					errHandler(errs["memmap"], where+"Banks are numbered from 0 to 255.")
+				}
+			}
+			if r.start+r.size > 0x10000 {
+				errHandler(errs["memmap"], where+"Region "+r.name+" extends past $FFFF.")
+			}
+			mm.regions = append(mm.regions, r)
+		case "segment":
+			s := segmentMap{name: fields[1], region: opts["region"], align: 1}
+			if _, ok := opts["align"]; ok {
+				s.align = mapNumber(opts["align"], where+"alignment")
+			}
+			_, s.bss = opts["bss"]
+			mm.segments = append(mm.segments, s)
+		default:
+			errHandler(errs["memmap"], where+"Expected region or segment.")
+		}
+	}
+	segments := mm.segments[:0]
+	for _, s := range mm.segments {
+		if findRegion(mm, s.region) < 0 {
+			errHandler(errs["memmap"], "Segment "+s.name+" uses undeclared region "+s.region+".")
+			continue // the language server goes on after errors
+		}
+		segments = append(segments, s)
+	}
+	mm.segments = segments
+	return
+}
+
+// Parses a $hex or decimal number from the memory map
+func mapNumber(str string, what string) int {
+	var n int64
+	var e error
+	if strings.HasPrefix(str, "$") {
+		n, e = strconv.ParseInt(str[1:], 16, 32)
+	} else {
+		n, e = strconv.ParseInt(str, 10, 32)
+	}
+	if e != nil || n < 0 || n > 0x10000 {
+		errHandler(errs["memmap"], "Missing or invalid "+what+".")
+	}
+	return int(n)
+}
+
+func findRegion(mm memoryMap, name string) int {
+	for i, r := range mm.regions {
+		if strings.EqualFold(r.name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func findSegment(mm memoryMap, name string) int {
+	for i, s := range mm.segments {
+		if strings.EqualFold(s.name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Reserves size bytes for a segment in its region and returns the start address
+func placeSegment(mm *memoryMap, seg int, size int, align int) int {
+	addr, over := fitSegment(mm, seg, size, align)
+	if over != "" {
+		errHandler(errs["overflow"], over)
+	}
+	return addr
+}
+
+// Like placeSegment, but returns how the segment overflows its region instead of reporting it
+func fitSegment(mm *memoryMap, seg int, size int, align int) (addr int, over string) {
+	s := mm.segments[seg]
+	r := &mm.regions[findRegion(*mm, s.region)]
+	if s.align > align {
+		align = s.align
+	}
+	addr = r.start + r.used
+	if align > 1 && addr%align != 0 {
+		addr += align - addr%align
+	}
+	if addr+size > r.start+r.size {
+		over = "Segment " + s.name + " overflows region " + r.name + " by " + strconv.Itoa(addr+size-r.start-r.size) + " bytes."
+	}
+	r.used = addr + size - r.start
+	return
+}
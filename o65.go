@@ -0,0 +1,213 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> o65.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"strings"
+)
+
+// o65 relocatable executables, as loaded by GeckOS, Lunix and similar systems. The object's
+// segments become the o65 text, data, bss and zero page segments; every relocation buildObject
+// made goes in the relocation tables, imports become undefined references and .export names the
+// globals. -o65-size 32 writes the sizes and addresses in the header as 32-bit numbers.
+
+var o65Size int = 16 // 16 or 32
+
+// o65 segment numbers
+const (
+	o65Undefined byte = iota
+	o65Absolute
+	o65Text
+	o65Data
+	o65Bss
+	o65Zero
+)
+
+// o65 relocation types
+const (
+	o65Word byte = 0x80
+	o65High byte = 0x40
+	o65Low  byte = 0x20
+)
+
+// The o65 segment an object segment goes in: ZEROPAGE and other reserved space, DATA, or text
+func o65Segment(seg objSegment) byte {
+	switch {
+	case seg.bss && strings.EqualFold(seg.name, "ZEROPAGE"):
+		return o65Zero
+	case seg.bss:
+		return o65Bss
+	case strings.EqualFold(seg.name, "DATA"):
+		return o65Data
+	}
+	return o65Text
+}
+
+type o65Reloc struct {
+	pos    int  // offset into the o65 segment
+	kind   byte // o65Word, o65High or o65Low
+	target byte // o65 segment of the address, or o65Undefined
+	index  int  // undefined reference number
+	low    byte // low byte of the address, kept for o65High
+}
+
+// Builds an o65 file from the object. Object segments that share an o65 segment must follow
+// each other in memory.
+func o65File(o objectFile, name string) []byte {
+	var buf bytes.Buffer
+	size := func(n int) {
+		if o65Size == 32 {
+			binary.Write(&buf, binary.LittleEndian, uint32(n))
+		} else {
+			binary.Write(&buf, binary.LittleEndian, uint16(n))
+		}
+	}
+
+	var base, length [o65Zero + 1]int
+	var data [o65Zero + 1][]byte
+	var relocs [o65Zero + 1][]o65Reloc
+	var order []int
+	for i := range o.segments {
+		order = append(order, i)
+	}
+	sort.SliceStable(order, func(a, b int) bool { return segBase[o.segments[order[a]].name] < segBase[o.segments[order[b]].name] })
+	var last [o65Zero + 1]string
+	align := 1
+	for _, i := range order {
+		seg := o.segments[i]
+		if seg.size == 0 {
+			continue
+		}
+		n := o65Segment(seg)
+		if last[n] == "" {
+			base[n] = segBase[seg.name]
+		} else if segBase[seg.name] != base[n]+length[n] {
+			errHandler(errs["format"], "Segments "+last[n]+" and "+seg.name+" go in the same o65 segment, so they must follow each other in memory.")
+		}
+		last[n] = seg.name
+		if seg.align > align {
+			align = seg.align
+		}
+		for _, r := range seg.relocs {
+			rel := o65Reloc{pos: segBase[seg.name] - base[n] + r.offset, target: o65Undefined, index: r.index}
+			rel.kind = map[byte]byte{relWord: o65Word, relLow: o65Low, relHigh: o65High}[r.size]
+			addr := r.addend
+			if r.target == relSegment {
+				target := o.segments[r.index]
+				rel.target = o65Segment(target)
+				addr += segBase[target.name]
+			}
+			rel.low = byte(addr)
+			relocs[n] = append(relocs[n], rel)
+		}
+		data[n] = append(data[n], seg.data...)
+		length[n] += seg.size
+	}
+
+	buf.Write([]byte{0x01, 0x00, 'o', '6', '5', 0x00})
+	var mode uint16
+	if o65Size == 32 {
+		mode |= 0x2000
+	}
+	switch { // the strictest alignment the segments need: byte, word, long or page
+	case align >= 0x100:
+		mode |= 3
+	case align >= 4:
+		mode |= 2
+	case align >= 2:
+		mode |= 1
+	}
+	binary.Write(&buf, binary.LittleEndian, mode)
+	for n := o65Text; n <= o65Zero; n++ {
+		size(base[n])
+		size(length[n])
+	}
+	size(0) // stack size, not known
+	for _, opt := range []struct {
+		kind byte
+		text string
+	}{{0, name}, {2, "ha6502"}} { // header options: file name and assembler
+		buf.WriteByte(byte(len(opt.text) + 3))
+		buf.WriteByte(opt.kind)
+		buf.WriteString(opt.text)
+		buf.WriteByte(0)
+	}
+	buf.WriteByte(0)
+	buf.Write(data[o65Text])
+	buf.Write(data[o65Data])
+
+	size(len(o.imports))
+	for _, imp := range o.imports {
+		buf.WriteString(imp)
+		buf.WriteByte(0)
+	}
+	for _, n := range []byte{o65Text, o65Data} {
+		sort.SliceStable(relocs[n], func(a, b int) bool { return relocs[n][a].pos < relocs[n][b].pos })
+		pos := -1
+		for _, rel := range relocs[n] {
+			for gap := rel.pos - pos; ; gap -= 254 {
+				if gap <= 254 {
+					buf.WriteByte(byte(gap))
+					break
+				}
+				buf.WriteByte(255)
+			}
+			pos = rel.pos
+			buf.WriteByte(rel.kind | rel.target)
+			if rel.target == o65Undefined {
+				size(rel.index)
+			}
+			if rel.kind == o65High {
+				buf.WriteByte(rel.low)
+			}
+		}
+		buf.WriteByte(0)
+	}
+
+	size(len(o.exports))
+	for _, exp := range o.exports {
+		buf.WriteString(exp.name)
+		buf.WriteByte(0)
+		if exp.segment < 0 {
+			buf.WriteByte(o65Absolute)
+			size(exp.value)
+		} else {
+			seg := o.segments[exp.segment]
+			buf.WriteByte(o65Segment(seg))
+			size(exp.value + segBase[seg.name])
+		}
+	}
+	return buf.Bytes()
+}
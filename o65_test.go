@@ -0,0 +1,144 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> o65_test.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+type testO65Reloc struct {
+	pos    int
+	kind   byte
+	target byte
+	low    byte
+}
+
+// Reads the text and data relocation tables of a 16-bit o65 file
+func readO65Relocs(t *testing.T, file []byte) (text, data []testO65Reloc) {
+	t.Helper()
+	word := func(at int) int { return int(binary.LittleEndian.Uint16(file[at:])) }
+	if string(file[2:5]) != "o65" || word(6)&0x2000 != 0 {
+		t.Fatalf("not a 16-bit o65 file: % x", file[:8])
+	}
+	p := 8 + 9*2
+	for file[p] != 0 { // header options
+		p += int(file[p])
+	}
+	p++
+	p += word(10) + word(14) // text and data
+	n := word(p)
+	for p += 2; n > 0; n-- { // undefined references
+		for file[p] != 0 {
+			p++
+		}
+		p++
+	}
+	table := func() (relocs []testO65Reloc) {
+		pos := -1
+		for file[p] != 0 {
+			if file[p] == 255 {
+				pos += 254
+				p++
+				continue
+			}
+			pos += int(file[p])
+			r := testO65Reloc{pos: pos, kind: file[p+1] & 0xe0, target: file[p+1] & 0x1f}
+			p += 2
+			if r.target == o65Undefined {
+				p += 2
+			}
+			if r.kind == o65High {
+				r.low = file[p]
+				p++
+			}
+			relocs = append(relocs, r)
+		}
+		p++
+		return
+	}
+	text = table()
+	data = table()
+	return
+}
+
+func TestO65Relocations(t *testing.T) {
+	insts, obj := testAssemble(t, `        org $1000
+start:  lda ptr
+        sta (ptr),y
+        jsr start
+        lda #>msg
+        .segment "DATA"
+msg:    dfb <msg,>msg,$00
+        .word start
+        .segment "ZEROPAGE"
+ptr:    .res 2
+`)
+	if len(diagnostics) > 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	text, data := readO65Relocs(t, o65File(buildObject(insts, obj), "test.o65"))
+	wantText := []testO65Reloc{{1, o65Low, o65Zero, 0}, {3, o65Low, o65Zero, 0}, {5, o65Word, o65Text, 0}, {8, o65High, o65Data, 0x09}}
+	wantData := []testO65Reloc{{0, o65Low, o65Data, 0}, {1, o65High, o65Data, 0x09}, {3, o65Word, o65Text, 0}}
+	for _, c := range []struct {
+		name      string
+		got, want []testO65Reloc
+	}{{"text", text, wantText}, {"data", data, wantData}} {
+		if len(c.got) != len(c.want) {
+			t.Errorf("%s relocations are %v, want %v", c.name, c.got, c.want)
+			continue
+		}
+		for i := range c.want {
+			if c.got[i] != c.want[i] {
+				t.Errorf("%s relocation %d is %v, want %v", c.name, i, c.got[i], c.want[i])
+			}
+		}
+	}
+}
+
+func TestO65LabelDifferences(t *testing.T) {
+	insts, obj := testAssemble(t, `        org $1000
+start:  lda #end-start
+        .word end-start
+        .segment "DATA"
+        dfb end-start
+        .segment "CODE"
+end:    rts
+`)
+	if len(diagnostics) > 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	text, data := readO65Relocs(t, o65File(buildObject(insts, obj), "test.o65"))
+	if len(text) != 0 || len(data) != 0 {
+		t.Errorf("got text relocations %v and data relocations %v, want none", text, data)
+	}
+}
@@ -0,0 +1,374 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> object.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+)
+
+// Relocatable object files
+// "HA65", version byte, then segments, exports and imports. All numbers are little-endian
+// uint16s and names are a length byte followed by the characters.
+
+const objMagic string = "HA65"
+const objVersion byte = 1
+
+// Relocation sizes
+const (
+	relWord byte = iota // full 16-bit address
+	relLow              // low byte of the address
+	relHigh             // high byte of the address
+)
+
+// Relocation targets
+const (
+	relSegment byte = iota // offset into one of the object's own segments
+	relImport              // address of an imported symbol
+)
+
+// The label a data byte is based on, which buildObject turns into a relocation
+type dataRef struct {
+	label  string // "" if the byte doesn't move
+	offset int    // constant added to the label's address
+	size   byte   // relWord, relLow or relHigh
+}
+
+// Makes the reference for a data item, the size of the item unless it takes the low or high byte
+// with <, >, lo() or hi()
+func dataReference(arg operand, refs []string, val int, size byte) dataRef {
+	ref := relocatableRef(arg, refs, val, instruction{})
+	switch ref.symByte {
+	case "<":
+		size = relLow
+	case ">":
+		size = relHigh
+	}
+	return dataRef{ref.symRef, ref.symOffset, size}
+}
+
+type relocation struct {
+	offset int  // position of the patched bytes within the segment
+	size   byte // relWord, relLow or relHigh
+	target byte // relSegment or relImport
+	index  int  // segment or import number
+	addend int  // added to the target's address
+}
+
+type objSegment struct {
+	name   string
+	data   []byte
+	size   int
+	align  int
+	bss    bool // reserves space without contributing bytes to the image
+	relocs []relocation
+}
+
+type objExport struct {
+	name    string
+	segment int // -1 for absolute values
+	value   int
+}
+
+type objectFile struct {
+	filename string
+	segments []objSegment
+	exports  []objExport
+	imports  []string
+}
+
+// Collects the assembled lines into one object segment per segment used. Code labels are offsets
+// from the start of their segment, so every operand that uses one gets a relocation, as does every
+// imported symbol. Relocations only matter to the linker; flat images ignore them.
+func buildObject(insts []instruction, obj [][]byte) (o objectFile) {
+	var segIndex = map[string]int{}
+	for _, name := range segNames {
+		segIndex[name] = len(o.segments)
+		o.segments = append(o.segments, objSegment{name: name, align: 1, bss: isBss(name)})
+	}
+	var importIndex = map[string]int{}
+	for _, sym := range symbols {
+		if sym.kind == "imp" {
+			importIndex[sym.label] = len(o.imports)
+			o.imports = append(o.imports, sym.label)
+		}
+	}
+	segs := lineSegments(insts)
+	for i, inst := range insts {
+		curLine = i
+		seg := &o.segments[segIndex[segs[i]]]
+		offset := seg.size
+		if seg.bss {
+			seg.size += reservedLength(inst, runAddr(i))
+		} else {
+			seg.size += len(obj[i])
+		}
+		if !seg.bss {
+			seg.data = append(seg.data, obj[i]...)
+		}
+		if inst.mnemonic == ".align" { // the linker has to place the segment on the boundary too
+			if n, _ := strconv.Atoi(inst.args[0]); n > seg.align {
+				seg.align = n
+			}
+		}
+		if len(obj[i]) == 0 {
+			continue
+		}
+		if inst.kind == "dat" {
+			for j, ref := range inst.dataRefs {
+				if r, ok := relocate(ref.label, ref.offset, offset+j, ref.size, segIndex, importIndex); ok {
+					seg.relocs = append(seg.relocs, r)
+				}
+			}
+		} else if inst.symRef != "" && inst.length == 3 {
+			if r, ok := relocate(inst.symRef, inst.symOffset, offset+1, relWord, segIndex, importIndex); ok {
+				seg.relocs = append(seg.relocs, r)
+			}
+		} else if inst.symRef != "" && inst.kind == "far" { // the jmp after the inverted branch
+			if r, ok := relocate(inst.symRef, inst.symOffset, offset+3, relWord, segIndex, importIndex); ok {
+				seg.relocs = append(seg.relocs, r)
+			}
+		} else if inst.symRef != "" && inst.kind == "imm" { // #<label or #>label
+			size := relLow
+			if inst.symByte == ">" {
+				size = relHigh
+			}
+			if r, ok := relocate(inst.symRef, inst.symOffset, offset+1, size, segIndex, importIndex); ok {
+				seg.relocs = append(seg.relocs, r)
+			}
+		} else if inst.length == 2 && inst.kind != "rel" && isZpSymbol(inst.symRef) { // a zero page label
+			if r, ok := relocate(inst.symRef, inst.symOffset, offset+1, relLow, segIndex, importIndex); ok {
+				seg.relocs = append(seg.relocs, r)
+			}
+		} else if sym, ok := lookupSymbol(inst.symRef); ok && sym.kind == "imp" {
+			errHandler(errs["reloc"], "Imported symbols can only be used as absolute addresses.")
+		}
+	}
+	for _, inst := range insts {
+		if inst.mnemonic != ".export" {
+			continue
+		}
+		for _, name := range inst.args {
+			sym, ok := lookupSymbol(name)
+			if !ok || sym.kind == "imp" {
+				errHandler(errs["unknownsym"], "Cannot export "+symbolHint(name)+".")
+				continue
+			}
+			exp := objExport{name, -1, sym.intAddr}
+			if sym.kind == "lbl" {
+				exp.segment = segIndex[sym.segment]
+				exp.value -= segBase[sym.segment]
+			}
+			o.exports = append(o.exports, exp)
+		}
+	}
+	return
+}
+
+// Adds imported names to the symbol table; the linker supplies their addresses
+func declareImports(names []string) {
+	for _, name := range names {
+		if !rLabel.MatchString(name) {
+			errHandler(errs["label"], "Cannot import "+name+".")
+		} else if symbolExists(name) {
+			errHandler(errs["duplicatesym"])
+		} else {
+			symbols = append(symbols, symbol{label: name, defLine: curLine, kind: "imp"})
+		}
+	}
+}
+
+// Makes the relocation for a symbol plus a constant used at offset, if the symbol needs one
+func relocate(label string, plus int, offset int, size byte, segIndex map[string]int, importIndex map[string]int) (relocation, bool) {
+	sym, ok := lookupSymbol(label)
+	if !ok {
+		return relocation{}, false
+	}
+	switch sym.kind {
+	case "lbl":
+		return relocation{offset, size, relSegment, segIndex[sym.segment], sym.intAddr - segBase[sym.segment] + plus}, true
+	case "imp":
+		return relocation{offset, size, relImport, importIndex[label], plus}, true
+	}
+	return relocation{}, false
+}
+
+func writeObject(filename string, o objectFile) {
+	var buf bytes.Buffer
+	word := func(n int) { binary.Write(&buf, binary.LittleEndian, uint16(n)) }
+	name := func(s string) {
+		buf.WriteByte(byte(len(s)))
+		buf.WriteString(s)
+	}
+	buf.WriteString(objMagic)
+	buf.WriteByte(objVersion)
+	word(len(o.segments))
+	for _, seg := range o.segments {
+		name(seg.name)
+		word(seg.size)
+		word(seg.align)
+		if seg.bss {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+			buf.Write(seg.data)
+		}
+		word(len(seg.relocs))
+		for _, r := range seg.relocs {
+			word(r.offset)
+			buf.WriteByte(r.size)
+			buf.WriteByte(r.target)
+			word(r.index)
+			word(r.addend)
+		}
+	}
+	word(len(o.exports))
+	for _, exp := range o.exports {
+		name(exp.name)
+		word(exp.segment)
+		word(exp.value)
+	}
+	word(len(o.imports))
+	for _, imp := range o.imports {
+		name(imp)
+	}
+	e := ioutil.WriteFile(filename, buf.Bytes(), 0644)
+	if e != nil {
+		errHandler(errs["file"])
+	}
+	fmt.Println("\nWrote " + strconv.Itoa(len(o.segments)) + " segment(s) to " + filename + ".")
+}
+
+func readObject(filename string) (o objectFile) {
+	file, e := ioutil.ReadFile(filename)
+	if e != nil {
+		errHandler(errs["file"], filename)
+		return
+	}
+	o.filename = filename
+	r := bytes.NewReader(file)
+	bad := false
+	word := func() int {
+		var n uint16
+		if binary.Read(r, binary.LittleEndian, &n) != nil {
+			bad = true
+		}
+		return int(n)
+	}
+	octet := func() byte {
+		b, e := r.ReadByte()
+		if e != nil {
+			bad = true
+		}
+		return b
+	}
+	name := func() string {
+		tmp := make([]byte, octet())
+		if n, _ := r.Read(tmp); n != len(tmp) {
+			bad = true
+		}
+		return string(tmp)
+	}
+	magic := make([]byte, len(objMagic))
+	r.Read(magic)
+	if string(magic) != objMagic || octet() != objVersion {
+		errHandler(errs["object"], filename+" is not an ha6502 object.")
+		return
+	}
+	for n := word(); n > 0 && !bad; n-- {
+		var seg objSegment
+		seg.name = name()
+		seg.size = word()
+		seg.align = word()
+		seg.bss = octet() == 1
+		if !seg.bss {
+			seg.data = make([]byte, seg.size)
+			if got, _ := r.Read(seg.data); got != seg.size {
+				bad = true
+			}
+		}
+		for m := word(); m > 0 && !bad; m-- {
+			var rel relocation
+			rel.offset = word()
+			rel.size = octet()
+			rel.target = octet()
+			rel.index = word()
+			rel.addend = word()
+			seg.relocs = append(seg.relocs, rel)
+		}
+		o.segments = append(o.segments, seg)
+	}
+	for n := word(); n > 0 && !bad; n-- {
+		var exp objExport
+		exp.name = name()
+		exp.segment = int(int16(word()))
+		exp.value = word()
+		o.exports = append(o.exports, exp)
+	}
+	for n := word(); n > 0 && !bad; n-- {
+		o.imports = append(o.imports, name())
+	}
+	if bad {
+		errHandler(errs["object"], filename+" is truncated.")
+	} else if e := checkObject(o); e != "" {
+		errHandler(errs["object"], filename+" is corrupt: "+e)
+		return objectFile{filename: filename}
+	}
+	return
+}
+
+// Checks that every relocation and export of an object read from a file refers to something in it
+func checkObject(o objectFile) string {
+	for _, seg := range o.segments {
+		for _, r := range seg.relocs {
+			switch {
+			case r.size > relHigh:
+				return "a relocation in " + seg.name + " has an unknown size."
+			case r.target == relSegment && r.index >= len(o.segments):
+				return "a relocation in " + seg.name + " refers to segment " + strconv.Itoa(r.index) + "."
+			case r.target == relImport && r.index >= len(o.imports):
+				return "a relocation in " + seg.name + " refers to import " + strconv.Itoa(r.index) + "."
+			case r.target > relImport:
+				return "a relocation in " + seg.name + " has an unknown target."
+			}
+		}
+	}
+	for _, exp := range o.exports {
+		if exp.segment < -1 || exp.segment >= len(o.segments) {
+			return exp.name + " is exported from segment " + strconv.Itoa(exp.segment) + "."
+		}
+	}
+	return ""
+}
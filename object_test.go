@@ -0,0 +1,118 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> object_test.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// Assembles src as a relocatable object
+func testObject(t *testing.T, src string) objectFile {
+	t.Helper()
+	relocatable = true
+	defer func() { relocatable = false }()
+	insts, obj := testAssemble(t, src)
+	if len(diagnostics) > 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	return buildObject(insts, obj)
+}
+
+// Places each segment of an object at the given address, the way the linker does
+func testLink(o objectFile, base int) []byte {
+	var image []byte
+	for _, seg := range o.segments {
+		for _, r := range seg.relocs {
+			patchRelocation(seg.data, r, base+r.addend, o.filename)
+		}
+		image = append(image, seg.data...)
+	}
+	return image
+}
+
+func TestDataByteRelocations(t *testing.T) {
+	o := testObject(t, "start:  rts\nvec:    dfb <msg,>msg,msg,<msg+1\nmsg:    dfb $00\n")
+	want := []relocation{{1, relLow, relSegment, 0, 5}, {2, relHigh, relSegment, 0, 5}, {3, relLow, relSegment, 0, 5}, {4, relLow, relSegment, 0, 6}}
+	relocs := o.segments[0].relocs
+	if len(relocs) != len(want) {
+		t.Fatalf("got relocations %v, want %v", relocs, want)
+	}
+	for i := range want {
+		if relocs[i] != want[i] {
+			t.Errorf("relocation %d is %v, want %v", i, relocs[i], want[i])
+		}
+	}
+	expectBytes(t, testLink(o, 0x0900), "60 05 09 05 06 00")
+}
+
+func TestWordRelocations(t *testing.T) {
+	o := testObject(t, "start:  .word start+2, $1234, >start\n")
+	expectBytes(t, testLink(o, 0x0900), "02 09 34 12 09 00")
+}
+
+// The difference of two labels is a constant wherever the object is placed
+func TestLabelDifferencesDontRelocate(t *testing.T) {
+	o := testObject(t, `start:  lda #end-start
+        dfb end-start
+        .word end-start
+end:    rts
+`)
+	if relocs := o.segments[0].relocs; len(relocs) != 0 {
+		t.Errorf("got relocations %v, want none", relocs)
+	}
+	expectBytes(t, testLink(o, 0xc010), "a9 05 05 05 00 60")
+}
+
+// A damaged object is reported instead of crashing the linker
+func TestCorruptObject(t *testing.T) {
+	good := testObject(t, "        .import out\nstart:  jsr out\n        jmp start\n")
+	for name, damage := range map[string]func(o *objectFile){
+		"segment index": func(o *objectFile) { o.segments[0].relocs[1].index = 9 },
+		"import index":  func(o *objectFile) { o.segments[0].relocs[0].index = 3 },
+		"export":        func(o *objectFile) { o.exports = []objExport{{"start", 4, 0}} },
+	} {
+		o := good
+		o.segments = append([]objSegment{}, good.segments...)
+		o.segments[0].relocs = append([]relocation{}, good.segments[0].relocs...)
+		damage(&o)
+		filename := filepath.Join(t.TempDir(), "test.obj")
+		writeObject(filename, o)
+		collectDiagnostics = true
+		diagnostics = nil
+		readObject(filename)
+		collectDiagnostics = false
+		if !hasDiagnostic("E0026") {
+			t.Errorf("%s: expected E0026, got %v", name, diagnostics)
+		}
+	}
+}
@@ -36,32 +36,58 @@ import "regexp"
 // Opcode tables
 // zop, imm, zp, zpx, abs, absx, absy, zpxi, zpiy, ind, rel
 
-// Regexp for matching operands
-var rOperand = regexp.MustCompile(`[(]?[#$]*[0-9a-f]{2,4}[,xy)]*`)
-var rImm = regexp.MustCompile(`^#[$]?[0-9a-f]{2}$`)
+// A hex byte, as in dfb lists
 var rZp = regexp.MustCompile(`^[$]?[0-9a-f]{2}$`)
-var rZpx = regexp.MustCompile(`^[$]?[0-9a-f]{2},x$`)
-var rZpy = regexp.MustCompile(`^[$]?[0-9a-f]{2},y$`)
-var rAbs = regexp.MustCompile(`^[$]?[0-9a-f]{4}$`)
-var rAbsx = regexp.MustCompile(`^[$]?[0-9a-f]{4},x$`)
-var rAbsy = regexp.MustCompile(`^[$]?[0-9a-f]{4},y$`)
-var rZpxi = regexp.MustCompile(`^[(][$]?(00)?[0-9a-f]{2},x[])]$`)
-var rZpiy = regexp.MustCompile(`^[(][$]?[0-9a-f]{2}[)],y$`)
-var rInd = regexp.MustCompile(`^[(][$]?[0-9a-f]{2,4}[)]$`)
 
 var rAddr = regexp.MustCompile(`[0-9a-f]{2,4}`)
+var rHex = regexp.MustCompile(`^[0-9a-f]+$`)
 
 // var rMnem = regexp.MustCompile(`^[A-Za-z]{3}$`)
 
 var rLabel = regexp.MustCompile(`^[A-Za-z]{1,6}$`)
 var rLabelCol = regexp.MustCompile(`^[A-Za-z]{1,6}:$`)
-var rLabelOpAbs = regexp.MustCompile(`^[A-Za-z]{1,6}$`)
-var rLabelOpInd = regexp.MustCompile(`^[(][A-Za-z]{1,6}[)]$`)
 
 var pseudoOps = map[string]string{
-	"dfb": "Define bytes of data",         // not yet implemented
-	"equ": "Store an address in a symbol", // not yet implemented
-	"org": "Set start address for program"}
+	".align":     "Pad to the next multiple of a boundary, optionally with a fill byte",
+	".assert":    "Stop with an error unless an expression is true",
+	".charmap":   "Set the code of one character in the current encoding",
+	".cycles":    "Count the cycles up to .endcycles, optionally checking the total",
+	".dephase":   "End a .phase block",
+	".encoding":  "Encode the strings that follow in ascii, apple, petscii, screen or atascii",
+	".endcycles": "End a .cycles block",
+	".endenum":   "End an .enum block",
+	".endfor":    "End a .for block",
+	".endpage":   "End a .page block",
+	".endproc":   "End a .proc block",
+	".endrept":   "End a .rept block",
+	".endscope":  "End a .scope block",
+	".endstruct": "End a .struct block, setting its name to its size",
+	".enum":      "Give each name up to .endenum the next number, from 0 or a given start",
+	".error":     "Stop with an error message",
+	".export":    "Make symbols visible to the linker",
+	".for":       "Repeat the lines up to .endfor for each value of a variable, e.g. .for i = 0, 255",
+	".import":    "Use symbols exported by another object",
+	".list":      "Resume the assembly listing",
+	".nolist":    "Suspend the assembly listing",
+	".page":      "Error if the code up to .endpage crosses a page boundary",
+	".phase":     "Assemble the lines up to .dephase to run at another address, e.g. .phase $0300",
+	".print":     "Print values and messages while assembling",
+	".proc":      "Start a subroutine: a label whose block has its own labels",
+	".rend":      "End a .rorg block",
+	".rept":      "Repeat the lines up to .endrept a number of times, e.g. .rept 8",
+	".res":       "Reserve bytes, or add a field of that size to a .struct",
+	".rorg":      "Same as .phase, ended by .rend",
+	".scope":     "Start a block with its own labels",
+	".segment":   "Continue in the named segment",
+	".set":       "Give a variable a value, which can be set again later; also name = value",
+	".struct":    "Start a struct: each .res up to .endstruct names a field at its offset",
+	".warning":   "Print a warning message",
+	".word":      "Define 16-bit words, low byte first, e.g. .word start, table+2",
+	".zp":        "Allocate a zero page variable of a given size, e.g. .zp ptr,2",
+	".zparea":    "Set the zero page range .zp allocates from, e.g. .zparea $80,$ff",
+	"dfb":        "Define bytes of data",
+	"equ":        "Store an address in a symbol",
+	"org":        "Set start address for program"}
 
 // including descriptions for a potential educational feature
 var mnemonics = map[string]string{
@@ -281,3 +307,58 @@ var opRel = map[string]byte{
 	"bpl": 0x10,
 	"bvc": 0x50,
 	"bvs": 0x70}
+
+// Base cycle counts by opcode, before page-crossing and branch-taken penalties
+var opCycles = map[byte]int{
+	0x00: 7, 0x01: 6, 0x05: 3, 0x08: 3, 0x09: 2, 0x0d: 4, 0x10: 2, 0x11: 5,
+	0x15: 4, 0x18: 2, 0x19: 4, 0x1d: 4, 0x20: 6, 0x24: 3, 0x26: 5, 0x28: 4,
+	0x2a: 2, 0x2c: 4, 0x2e: 6, 0x30: 2, 0x36: 6, 0x38: 2, 0x3e: 7, 0x40: 6,
+	0x41: 6, 0x45: 3, 0x46: 5, 0x48: 3, 0x49: 2, 0x4a: 2, 0x4c: 3, 0x4d: 4,
+	0x4e: 6, 0x50: 2, 0x51: 5, 0x55: 4, 0x56: 6, 0x58: 2, 0x59: 4, 0x5d: 4,
+	0x5e: 7, 0x60: 6, 0x61: 6, 0x65: 3, 0x66: 5, 0x68: 4, 0x69: 2, 0x6a: 2,
+	0x6c: 5, 0x6d: 4, 0x6e: 6, 0x70: 2, 0x71: 5, 0x75: 4, 0x76: 6, 0x78: 2,
+	0x79: 4, 0x7d: 4, 0x7e: 7, 0x81: 6, 0x84: 3, 0x85: 3, 0x86: 3, 0x88: 2,
+	0x8a: 2, 0x8c: 4, 0x8d: 4, 0x8e: 4, 0x90: 2, 0x91: 6, 0x94: 4, 0x95: 4,
+	0x96: 4, 0x98: 2, 0x99: 5, 0x9a: 2, 0x9d: 5, 0xa0: 2, 0xa1: 6, 0xa2: 2,
+	0xa4: 3, 0xa5: 3, 0xa6: 3, 0xa8: 2, 0xa9: 2, 0xaa: 2, 0xac: 4, 0xad: 4,
+	0xae: 4, 0xb0: 2, 0xb1: 5, 0xb4: 4, 0xb5: 4, 0xb6: 4, 0xb8: 2, 0xb9: 4,
+	0xba: 2, 0xbc: 4, 0xbd: 4, 0xbe: 4, 0xc0: 2, 0xc1: 6, 0xc4: 3, 0xc5: 3,
+	0xc6: 5, 0xc8: 2, 0xc9: 2, 0xca: 2, 0xcc: 4, 0xcd: 4, 0xce: 6, 0xd0: 2,
+	0xd1: 5, 0xd5: 4, 0xd6: 6, 0xd8: 2, 0xd9: 4, 0xdd: 4, 0xde: 7, 0xe0: 2,
+	0xe1: 6, 0xe4: 3, 0xe5: 3, 0xe6: 5, 0xe8: 2, 0xe9: 2, 0xea: 2, 0xec: 4,
+	0xed: 4, 0xee: 6, 0xf0: 2, 0xf1: 5, 0xf5: 4, 0xf6: 6, 0xf8: 2, 0xf9: 4,
+	0xfd: 4, 0xfe: 7}
+
+type addrMode struct {
+	kind    string
+	name    string
+	example string
+	table   map[string]byte
+	length  int
+}
+
+// Opcode tables by addressing mode, in the order they're listed for a mnemonic
+var addrModes = []addrMode{
+	{"zop", "implied", "", opZop, 1},
+	{"imm", "immediate", "#$44", opImm, 2},
+	{"zp", "zero page", "$44", opZp, 2},
+	{"zpx", "zero page,X", "$44,x", opZpx, 2},
+	{"zpy", "zero page,Y", "$44,y", opZpy, 2},
+	{"abs", "absolute", "$4400", opAbs, 3},
+	{"absx", "absolute,X", "$4400,x", opAbsx, 3},
+	{"absy", "absolute,Y", "$4400,y", opAbsy, 3},
+	{"ind", "indirect", "($4400)", opInd, 3},
+	{"zpxi", "indexed indirect", "($44,x)", opZpxi, 2},
+	{"zpiy", "indirect indexed", "($44),y", opZpiy, 2},
+	{"rel", "relative", "label", opRel, 2}}
+
+// The branch taken on the opposite condition
+var invertBranch = map[string]string{
+	"bcc": "bcs",
+	"bcs": "bcc",
+	"beq": "bne",
+	"bmi": "bpl",
+	"bne": "beq",
+	"bpl": "bmi",
+	"bvc": "bvs",
+	"bvs": "bvc"}
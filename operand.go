@@ -0,0 +1,240 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> operand.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// An operand, read from the tokens of its line once: the addressing mode, the expression giving
+// its value, and which byte that value selects with <, >, lo() or hi(), if any
+type operand struct {
+	toks  []token // the whole operand
+	mode  string  // "", imm, x, y, ind, zpxi or zpiy
+	expr  []token // the value, without the #, brackets and index register of the mode
+	byte  string  // < or > when the value is the low or high byte of inner
+	inner []token
+}
+
+// Reads the addressing mode of an instruction's operand: "#e" is imm, "(e,x)" zpxi, "(e),y" zpiy,
+// "(e)" ind, "e,x" x, "e,y" y, and anything else a plain value
+func readOperand(toks []token) operand {
+	n := len(toks)
+	is := func(i int, text string) bool { return i >= 0 && i < n && strings.EqualFold(toks[i].text, text) }
+	wrapped := is(0, "(") && closingParen(toks) == n-1
+	switch {
+	case is(0, "#"):
+		return readValue(toks, "imm", toks[1:])
+	case wrapped && is(n-3, ",") && is(n-2, "x"):
+		return readValue(toks, "zpxi", toks[1:n-3])
+	case is(0, "(") && is(n-3, ")") && is(n-2, ",") && is(n-1, "y") && closingParen(toks) == n-3:
+		return readValue(toks, "zpiy", toks[1:n-3])
+	case wrapped:
+		return readValue(toks, "ind", toks[1:n-1])
+	case is(n-2, ",") && is(n-1, "x"):
+		return readValue(toks, "x", toks[:n-2])
+	case is(n-2, ",") && is(n-1, "y"):
+		return readValue(toks, "y", toks[:n-2])
+	}
+	return readValue(toks, "", toks)
+}
+
+// Reads the value of an operand in the given mode, noting the byte it selects
+func readValue(toks []token, mode string, expr []token) operand {
+	arg := operand{toks: toks, mode: mode, expr: expr}
+	n := len(expr)
+	switch {
+	case n > 1 && (expr[0].text == "<" || expr[0].text == ">"):
+		arg.byte, arg.inner = expr[0].text, expr[1:]
+	case n > 3 && expr[1].text == "(" && closingParen(expr[1:]) == n-2:
+		if b, ok := map[string]string{"lo": "<", "hi": ">"}[strings.ToLower(expr[0].text)]; ok {
+			arg.byte, arg.inner = b, expr[2:n-1]
+		}
+	}
+	return arg
+}
+
+// Reads a lone value, such as a data item, as an operand
+func valueOperand(src string) (operand, error) {
+	toks, err, _ := lex(src)
+	if err != "" {
+		return operand{}, errors.New(err)
+	}
+	return readValue(toks, "", toks), nil
+}
+
+// The operand as written, without whitespace
+func (arg operand) text() (str string) {
+	for _, tok := range arg.toks {
+		str += tok.text
+	}
+	return
+}
+
+// The index of the token closing the bracket that starts toks, or -1
+func closingParen(toks []token) int {
+	depth := 0
+	for i, tok := range toks {
+		switch tok.text {
+		case "(":
+			depth++
+		case ")":
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Whether an operand needs the expression parser: it uses an operator other than the brackets,
+// comma and # of the addressing modes, a name that isn't hex digits or an index register, a
+// character, or a binary number. Plain hex operands are read by parseOperand.
+func isExprOperand(toks []token) bool {
+	for _, tok := range toks {
+		lower := strings.ToLower(tok.text)
+		switch tok.kind {
+		case "op":
+			if !strings.Contains("#(),", tok.text) {
+				return true
+			}
+		case "name":
+			if lower != "x" && lower != "y" && (!rHex.MatchString(lower) || scopedSymbolExists(lower) || isVariable(tok.text)) {
+				return true
+			}
+		case "number":
+			if tok.text[0] == '%' {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// Reads an operand made of labels and expressions, e.g. "tbl+1,x", "(ptr),y" or "#>msg". A value
+// that fits in a byte uses zero page when the instruction has that mode and every symbol in it can
+// (see isZpSymbol). Until all its symbols are defined, an operand is sized as absolute.
+func parseExprOperand(arg operand, inst instruction) instruction {
+	if strings.EqualFold(arg.text(), "a") && opZop[inst.mnemonic] > 0 { // check for ror a, rol a, similar
+		inst.kind = "zop"
+		inst.length = 1
+		return inst
+	}
+	mode := arg.mode
+	pc := -1
+	if pass > 1 && curLine < len(passAddrs) {
+		pc = passAddrs[curLine]
+	}
+	val, refs, unknown, e := evalTokens(arg.expr, pc)
+	if e != nil {
+		errHandler(errs["operand"], e.Error())
+		return inst
+	}
+	if len(unknown) > 0 && pass > 1 {
+		errHandler(errs["unknownsym"], symbolHint(unknown[0]))
+	}
+	zp := len(unknown) == 0 && val >= 0 && val <= 0xff
+	for _, ref := range refs {
+		addReference(ref, inst.mnemonic)
+		zp = zp && isZpSymbol(ref)
+	}
+	inst = relocatableRef(arg, refs, val, inst)
+	_, hasZp := opZp[inst.mnemonic]
+	_, hasZpx := opZpx[inst.mnemonic]
+	_, hasZpy := opZpy[inst.mnemonic]
+	_, isRel := opRel[inst.mnemonic]
+	inst.kind, inst.length = "abs", 3
+	switch {
+	case mode == "imm":
+		inst.kind, inst.length = "imm", 2
+		if val < -128 || val > 0xff {
+			errHandler(errs["operand"], fmt.Sprintf("%d ($%X) doesn't fit in a byte.", val, val))
+		}
+	case mode == "" && isRel:
+		inst.kind, inst.length = "rel", 2
+	case mode == "" && zp && hasZp:
+		inst.kind, inst.length = "zp", 2
+	case mode == "x":
+		inst.kind = "absx"
+		if zp && hasZpx {
+			inst.kind, inst.length = "zpx", 2
+		}
+	case mode == "y":
+		inst.kind = "absy"
+		if zp && hasZpy {
+			inst.kind, inst.length = "zpy", 2
+		}
+	case mode == "ind":
+		inst.kind = "ind"
+	case mode == "zpxi" || mode == "zpiy":
+		inst.kind, inst.length = mode, 2
+		if len(unknown) == 0 && (val < 0 || val > 0xff) {
+			errHandler(errs["operand"], "Indexed indirect addressing needs a zero page address.")
+		}
+	}
+	if inst.length == 3 && len(unknown) == 0 && (val < 0 || val > 0xffff) {
+		errHandler(errs["operand"], fmt.Sprintf("%d ($%X) is not an address.", val, val))
+	}
+	inst.opLowByte = byte(val)
+	inst.opHighByte = byte(val >> 8) // for branches, the target; asmObject works out the displacement
+	return sizeBranch(inst)
+}
+
+// Finds the label or import an operand's value is based on, which buildObject turns into a
+// relocation: the only relocatable symbol in the expression, plus a constant. An operand that
+// selects a byte with <, >, lo() or hi() takes the low or high byte of it.
+func relocatableRef(arg operand, refs []string, val int, inst instruction) instruction {
+	inst.symRef, inst.symOffset, inst.symByte = "", 0, ""
+	for _, ref := range refs {
+		if sym, _ := lookupSymbol(ref); sym.kind == "lbl" || sym.kind == "imp" {
+			if inst.symRef != "" && inst.symRef != ref { // the difference of two labels doesn't move
+				inst.symRef, inst.symOffset = "", 0
+				return inst
+			}
+			inst.symRef = ref
+		}
+	}
+	if inst.symRef == "" {
+		return inst
+	}
+	sym, _ := lookupSymbol(inst.symRef)
+	if arg.byte != "" {
+		inst.symByte = arg.byte
+		val, _, _, _ = evalTokens(arg.inner, -1)
+	}
+	inst.symOffset = val - sym.intAddr
+	return inst
+}
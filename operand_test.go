@@ -0,0 +1,93 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> operand_test.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Plain hex operands take their mode from operandMode and their size from the number of digits
+func TestHexOperandModes(t *testing.T) {
+	for _, c := range []struct{ line, want string }{
+		{"lda #$0a", "a9 0a"},
+		{"lda $10", "a5 10"},
+		{"lda $0010", "ad 10 00"},
+		{"lda $10,x", "b5 10"},
+		{"lda $1234,X", "bd 34 12"},
+		{"ldx $10,y", "b6 10"},
+		{"lda $1234,y", "b9 34 12"},
+		{"lda ($10,x)", "a1 10"},
+		{"lda ($0010,x)", "a1 10"},
+		{"LDA ($0A),Y", "b1 0a"},
+		{"jmp ($1234)", "6c 34 12"},
+		{"bne $1000", "d0 fe"},
+		{"ror a", "6a"},
+	} {
+		_, obj := testAssemble(t, "        org $1000\n        "+c.line+"\n")
+		if len(diagnostics) > 0 {
+			t.Errorf("%s: %v", c.line, diagnostics)
+			continue
+		}
+		if got := fmt.Sprintf("% x", flatBytes(obj)); got != c.want {
+			t.Errorf("%s assembled to %s, want %s", c.line, got, c.want)
+		}
+	}
+	for _, line := range []string{"lda #$1234", "lda $123", "lda ($1010,x)", "lda ($1234),y"} {
+		testAssemble(t, "        org $1000\n        "+line+"\n")
+		if !hasDiagnostic("E0032") {
+			t.Errorf("%s: expected E0032, got %v", line, diagnostics)
+		}
+	}
+}
+
+func TestReadOperand(t *testing.T) {
+	for _, c := range []struct{ op, mode, expr, byte, inner string }{
+		{"#<msg", "imm", "<msg", "<", "msg"},
+		{"#hi(msg)", "imm", "hi(msg)", ">", "msg"},
+		{"#hi(msg)+1", "imm", "hi(msg)+1", "", ""},
+		{"(ptr,x)", "zpxi", "ptr", "", ""},
+		{"( ptr ) , Y", "zpiy", "ptr", "", ""},
+		{"(vec)", "ind", "vec", "", ""},
+		{"(2+3)*2", "", "(2+3)*2", "", ""},
+		{"tbl+1,x", "x", "tbl+1", "", ""},
+		{">tbl,y", "y", ">tbl", ">", "tbl"},
+		{"end-start", "", "end-start", "", ""},
+		{"';'", "", "';'", "", ""},
+	} {
+		arg := parseStatement("        lda " + c.op).arg
+		expr, inner := operand{toks: arg.expr}.text(), operand{toks: arg.inner}.text()
+		if arg.mode != c.mode || expr != c.expr || arg.byte != c.byte || inner != c.inner {
+			t.Errorf("%s read as mode %q, expression %q, byte %q of %q", c.op, arg.mode, expr, arg.byte, inner)
+		}
+	}
+}
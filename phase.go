@@ -0,0 +1,137 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> phase.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Code assembled to run at one address while it is loaded at another, such as a routine copied
+// from ROM to RAM: .phase addr (or .rorg addr) up to .dephase (or .rend). Labels, branches and *
+// inside use the run address; the bytes still go at the load address.
+
+var runOffsets []int    // run address minus load address of each instruction, as of the last pass
+var phaseStart int = -1 // line of the open .phase, -1 if none
+
+// Closes any .phase left open at the start of each pass
+func resetPhase() {
+	phaseStart = -1
+}
+
+// Reads the run address of .phase or .rorg
+func parsePhase(op string, inst instruction) instruction {
+	val, _, unknown, e := evalOperand(op, -1)
+	if e == nil && len(unknown) > 0 && pass > 1 {
+		e = fmt.Errorf("Unknown symbol %s.", symbolHint(unknown[0]))
+	}
+	if e != nil || val < 0 || val > 0xffff {
+		errHandler(errs["phaseblock"], "Expected the address the code will run at, e.g. .phase $0300.")
+		return inst
+	}
+	inst.opLowByte = byte(val)
+	inst.opHighByte = byte(val >> 8)
+	return inst
+}
+
+// Opens and closes .phase blocks. A block stays in the segment it starts in.
+func parsePhaseBlock(cur instruction) instruction {
+	switch cur.mnemonic {
+	case ".phase", ".rorg":
+		if relocatable {
+			errHandler(errs["reloc"], "Phased code would need relocating to its run address.")
+		} else if phaseStart >= 0 {
+			errHandler(errs["phaseblock"], ".phase blocks can't be nested; the last one starts on line "+strconv.Itoa(sourceLine(phaseStart)+1)+".")
+		}
+		phaseStart = curLine
+		if cur.label != "" {
+			cur.kind = "" // a label on the .phase line is where the block is loaded
+		}
+	case ".dephase", ".rend":
+		if phaseStart < 0 {
+			opener := map[string]string{".dephase": ".phase", ".rend": ".rorg"}[cur.mnemonic]
+			errHandler(errs["phaseblock"], cur.mnemonic+" without "+opener+".")
+		}
+		phaseStart = -1
+	case ".segment":
+		if phaseStart >= 0 {
+			errHandler(errs["phaseblock"], "Close the .phase on line "+strconv.Itoa(sourceLine(phaseStart)+1)+" before changing segments.")
+		}
+	}
+	return cur
+}
+
+// Checks that the last .phase was closed
+func checkPhase() {
+	if phaseStart >= 0 {
+		curLine = phaseStart
+		errHandler(errs["phaseblock"], ".phase without .dephase.")
+	}
+}
+
+// How far the run address of each line is from where it is loaded, given each line's load address
+func phaseOffsets(insts []instruction, addrs []int) (offsets []int) {
+	offset := 0
+	for i, inst := range insts {
+		if inst.mnemonic == ".dephase" || inst.mnemonic == ".rend" {
+			offset = 0
+		}
+		offsets = append(offsets, offset) // .phase itself is still at its load address
+		if inst.mnemonic == ".phase" || inst.mnemonic == ".rorg" {
+			offset = hexToInt([2]byte{inst.opHighByte, inst.opLowByte}) - addrs[i]
+		}
+	}
+	return
+}
+
+// How far an instruction's run address is from its load address in the last pass
+func runOffset(i int) int {
+	if i < len(runOffsets) {
+		return runOffsets[i]
+	}
+	return 0
+}
+
+// The address an instruction runs at: its load address, unless it is in a .phase block
+func runAddr(i int) int {
+	return lineAddrs[i] + runOffset(i)
+}
+
+// Whether any code runs somewhere other than where it is loaded, so the listing shows both
+func isPhased() bool {
+	for _, offset := range runOffsets {
+		if offset != 0 {
+			return true
+		}
+	}
+	return false
+}
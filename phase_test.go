@@ -0,0 +1,95 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> phase_test.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import "testing"
+
+// Labels, branches and * in a .phase block use the address it runs at; its bytes and the lines
+// after it stay where they are loaded
+func TestPhaseAddresses(t *testing.T) {
+	insts, obj := testAssemble(t, `        org $0800
+copy:   lda code,x
+        sta $0300,x
+code:   .phase $0300
+run:    lda #$01
+        bne run
+        dfb <*
+        .dephase
+after:  rts
+`)
+	if len(diagnostics) > 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	expectBytes(t, flatBytes(obj), "bd 06 08 9d 00 03 a9 01 d0 fc 04 60")
+	want := map[string]int{"code": 0x0806, "run": 0x0300, "after": 0x080b}
+	values := symbolValues()
+	for name, val := range want {
+		if values[name] != val {
+			t.Errorf("%s = $%04X, want $%04X", name, values[name], val)
+		}
+	}
+	if lineAddrs[4] != 0x0806 || runAddr(4) != 0x0300 || runAddr(8) != 0x080b {
+		t.Errorf("run line loaded at $%04X and runs at $%04X; after runs at $%04X", lineAddrs[4], runAddr(4), runAddr(8))
+	}
+	if !isPhased() || insts[4].label != "run" {
+		t.Error("phased block not noticed")
+	}
+}
+
+func TestRorg(t *testing.T) {
+	_, obj := testAssemble(t, `        org $0800
+        .rorg $c000
+        jmp *
+        .rend
+        jmp *
+`)
+	if len(diagnostics) > 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	expectBytes(t, flatBytes(obj), "4c 00 c0 4c 03 08")
+}
+
+func TestPhaseErrors(t *testing.T) {
+	for _, src := range []string{
+		"        .phase $0300\n        .phase $0400\n        .dephase\n",
+		"        .dephase\n",
+		"        .rend\n",
+		"        .phase $10000\n        .dephase\n",
+		"        .phase\n        .dephase\n",
+		"        .phase $0300\n        .segment \"DATA\"\n        .dephase\n",
+	} {
+		testAssemble(t, src)
+		if !hasDiagnostic(errs["phaseblock"][2]) {
+			t.Errorf("%q: got %v, want %s", src, diagnostics, errs["phaseblock"][2])
+		}
+	}
+}
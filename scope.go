@@ -0,0 +1,216 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> scope.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The scope being assembled, as the prefix its symbols get, e.g. "print::" inside .proc print
+var curScope string
+
+// An open .proc or .scope block
+type scopeBlock struct {
+	directive string // .proc or .scope
+	start     int    // line it opened on
+}
+
+var scopeBlocks []scopeBlock // open blocks, innermost last
+var lineScopes []string      // scope of each line as of the last pass
+
+// First and last instruction of each named block, kept from pass to pass for sizeof
+var scopeSpans = map[string][2]int{}
+
+// Leaves every scope at the start of each pass
+func resetScopes() {
+	curScope = ""
+	scopeBlocks = nil
+	lineScopes = nil
+}
+
+// Opens and closes .proc and .scope blocks. Labels inside get the block's name as a prefix, so
+// two procs can each have a loop. A .proc is also a label for its first address.
+func parseScope(cur instruction) instruction {
+	switch cur.mnemonic {
+	case ".proc", ".scope":
+		name := cur.label
+		if len(cur.args) > 0 {
+			name = cur.args[0]
+		}
+		cur.label = ""
+		if name == "" && cur.mnemonic == ".scope" {
+			// anonymous, so nothing outside can refer to it; each copy made by a loop gets its own
+			name = "@" + strconv.Itoa(sourceLine(curLine)+1)
+			if sourceLine(curLine) != curLine {
+				name += "." + strconv.Itoa(curLine+1)
+			}
+		} else if !rLabel.MatchString(name) {
+			errHandler(errs["scope"], "Expected a name for the "+cur.mnemonic[1:]+".")
+			return cur
+		}
+		if cur.mnemonic == ".proc" {
+			cur.label, cur.kind = name, "" // placed by getSymbols like a label on its own
+		}
+		scopeBlocks = append(scopeBlocks, scopeBlock{cur.mnemonic, curLine})
+		curScope += name + "::"
+	case ".endproc", ".endscope":
+		open := "." + strings.TrimPrefix(cur.mnemonic, ".end")
+		n := len(scopeBlocks)
+		if n == 0 {
+			errHandler(errs["scope"], cur.mnemonic+" without "+open+".")
+			return cur
+		}
+		if last := scopeBlocks[n-1]; last.directive != open {
+			errHandler(errs["scope"], fmt.Sprintf("Expected .end%s for the %s on line %d.", last.directive[1:], last.directive, sourceLine(last.start)+1))
+			return cur
+		}
+		if !strings.HasPrefix(localName(strings.TrimSuffix(curScope, "::")), "@") {
+			scopeSpans[curScope] = [2]int{scopeBlocks[n-1].start, curLine}
+		}
+		scopeBlocks = scopeBlocks[:n-1]
+		curScope = parentScope(curScope)
+	}
+	return cur
+}
+
+// Checks that every .proc and .scope was closed
+func checkScopes() {
+	for _, block := range scopeBlocks {
+		curLine = block.start
+		errHandler(errs["scope"], "Block is missing its end.")
+	}
+}
+
+// The names a symbol could have as seen from a scope, innermost first, so that a name defined in a
+// .proc hides the same name outside it. Qualified names such as print::loop are found the same way,
+// and a name starting with :: is only looked for outside every scope.
+func scopedNames(name string, scope string) (names []string) {
+	if strings.HasPrefix(name, "::") {
+		return []string{name[2:]}
+	}
+	for ; scope != ""; scope = parentScope(scope) {
+		names = append(names, scope+name)
+	}
+	return append(names, name)
+}
+
+// Looks a name up from the scope being assembled
+func lookupScoped(name string) (symbol, bool) {
+	for _, n := range scopedNames(name, curScope) {
+		if sym, ok := lookupSymbol(n); ok {
+			return sym, true
+		}
+	}
+	return symbol{}, false
+}
+
+func scopedSymbolExists(name string) bool {
+	_, ok := lookupScoped(name)
+	return ok
+}
+
+// The scope around a scope, e.g. "print::" for "print::inner::"
+func parentScope(scope string) string {
+	scope = strings.TrimSuffix(scope, "::")
+	if i := strings.LastIndex(scope, "::"); i >= 0 {
+		return scope[:i+2]
+	}
+	return ""
+}
+
+// A symbol's name within its scope, e.g. loop for print::loop
+func localName(label string) string {
+	if i := strings.LastIndex(label, "::"); i >= 0 {
+		return label[i+2:]
+	}
+	return label
+}
+
+// Adds a scope's symbols to the symbol table in the log, followed by each scope inside it under
+// its name, indented a level deeper
+func logScope(scope string, depth int) {
+	indent := strings.Repeat("  ", depth)
+	var syms []symbol
+	inner := map[string]bool{}
+	for _, sym := range symbols {
+		if !strings.HasPrefix(sym.label, scope) {
+			continue
+		}
+		rest := sym.label[len(scope):]
+		if i := strings.Index(rest, "::"); i < 0 {
+			syms = append(syms, sym)
+		} else {
+			inner[rest[:i]] = true
+		}
+	}
+	sort.SliceStable(syms, func(i, j int) bool { return syms[i].label < syms[j].label })
+	var names, values []string
+	for _, sym := range syms {
+		names = append(names, localName(sym.label))
+		if sym.kind == "imp" {
+			values = append(values, "import")
+		} else if bank := symbolBank(sym); bank >= 0 {
+			values = append(values, fmt.Sprintf("$%02X:%04X", bank, sym.intAddr))
+		} else {
+			values = append(values, fmt.Sprintf("$%04X", sym.intAddr))
+		}
+	}
+	logColumns(names, values, indent)
+	var scopes []string
+	for name := range inner {
+		scopes = append(scopes, name)
+	}
+	sort.Strings(scopes)
+	for _, name := range scopes {
+		log += "\n" + indent + name + "::\n"
+		logScope(scope+name+"::", depth+1)
+	}
+}
+
+// Adds names and their values to the log in the symbol table's columns, starting each row with indent
+func logColumns(names []string, values []string, indent string) {
+	var colWidth int = 60
+	var runWidth int = 0
+	log += indent
+	for i, name := range names {
+		if runWidth > colWidth {
+			log += "\n" + indent
+			runWidth = 0
+		}
+		tmp := setStringToWidth(name, 8) + setStringToWidth(values[i], 12)
+		runWidth += len(tmp)
+		log += tmp
+	}
+}
@@ -0,0 +1,109 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> scope_test.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScopedNames(t *testing.T) {
+	for _, test := range []struct{ name, scope, want string }{
+		{"loop", "", "loop"},
+		{"loop", "print::", "print::loop loop"},
+		{"loop", "print::inner::", "print::inner::loop print::loop loop"},
+		{"print::done", "main::", "main::print::done print::done"},
+		{"::loop", "print::inner::", "loop"},
+	} {
+		if got := strings.Join(scopedNames(test.name, test.scope), " "); got != test.want {
+			t.Errorf("%s from %q: got %s, want %s", test.name, test.scope, got, test.want)
+		}
+	}
+	if got := parentScope("print::inner::"); got != "print::" {
+		t.Errorf("parent of print::inner:: is %q", got)
+	}
+	if got := localName("print::inner::loop"); got != "loop" {
+		t.Errorf("local name of print::inner::loop is %q", got)
+	}
+}
+
+// Each block has its own labels; a name means the innermost definition, and :: reaches past them
+func TestScopeLookup(t *testing.T) {
+	_, obj := testAssemble(t, `        org $0800
+loop:   jsr print
+        jmp print::done
+        .proc print
+        ldx #$00
+loop:   lda msg,x
+        beq done
+        jsr ::loop
+        .scope
+loop:   inx
+        bne loop
+        .endscope
+        bne loop
+done:   rts
+        .endproc
+        .proc other
+loop:   jmp loop
+        .endproc
+msg:    dfb $00
+`)
+	if len(diagnostics) > 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	want := map[string]int{"loop": 0x0800, "print": 0x0806, "print::loop": 0x0808, "print::@9::loop": 0x0810,
+		"print::done": 0x0815, "other": 0x0816, "other::loop": 0x0816, "msg": 0x0819}
+	values := symbolValues()
+	for name, val := range want {
+		if v, ok := values[name]; !ok || v != val {
+			t.Errorf("%s = $%04X (defined %v), want $%04X", name, v, ok, val)
+		}
+	}
+	expectBytes(t, flatBytes(obj), "20 06 08 4c 15 08 a2 00 bd 19 08 f0 08 20 00 08 e8 d0 fd d0 f3 60 4c 16 08 00")
+}
+
+func TestScopeErrors(t *testing.T) {
+	for _, test := range []struct{ src, err string }{
+		{"        .proc print\n        rts\n", "scope"},
+		{"        .proc print\n        .endscope\n", "scope"},
+		{"        .endproc\n", "scope"},
+		{"        .proc\n        .endproc\n", "scope"},
+		{"        .proc print\ndone:   rts\n        .endproc\n        jmp done\n", "unknownsym"},
+		{"        .proc print\n        rts\n        .endproc\n        jmp print::done\n", "unknownsym"},
+	} {
+		testAssemble(t, test.src)
+		if !hasDiagnostic(errs[test.err][2]) {
+			t.Errorf("%q: got %v, want %s", test.src, diagnostics, errs[test.err][2])
+		}
+	}
+}
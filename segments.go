@@ -0,0 +1,116 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> segments.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import "strings"
+
+// Segments gather code and data from anywhere in the source into one block of memory. The memory
+// map (-map) says where each segment goes; without one, segments follow each other from org.
+
+var memMap memoryMap           // regions and the segments placed in them
+var segNames []string          // segments in order of first use
+var segBase = map[string]int{} // start address of each segment (0 in relocatable objects)
+
+// Returns the segment each line belongs to. Code starts in CODE until a .segment directive.
+func lineSegments(insts []instruction) (segs []string) {
+	var cur string = "CODE"
+	for _, inst := range insts {
+		if inst.mnemonic == ".segment" && len(inst.args) == 1 {
+			cur = strings.ToUpper(inst.args[0])
+		}
+		segs = append(segs, cur)
+	}
+	return
+}
+
+// The memory map used without -map: ZEROPAGE at $0000 and everything else in use
+// following CODE, DATA and BSS from org
+func defaultMemoryMap() (mm memoryMap) {
+	mm.regions = []region{{"ZP", 0x0000, 0x0100, -1, -1, 0}, {"MAIN", org, 0x10000 - org, -1, -1, 0}}
+	mm.segments = []segmentMap{{"ZEROPAGE", "ZP", 1, true}, {"CODE", "MAIN", 1, false}, {"DATA", "MAIN", 1, false}, {"BSS", "MAIN", 1, true}}
+	for _, name := range segNames {
+		if findSegment(mm, name) < 0 {
+			mm.segments = append(mm.segments, segmentMap{name, "MAIN", 1, false})
+		}
+	}
+	return
+}
+
+// Regions the last layout overflowed. Until the passes settle, forward references are sized as
+// absolute, so only the final layout is checked.
+var overflows []string
+
+// Places the segments in use, sized by getSymbols, into the regions of the memory map
+func layoutSegments(sizes map[string]int) {
+	segBase = map[string]int{}
+	overflows = nil
+	if mapFilename == "" {
+		memMap = defaultMemoryMap()
+	}
+	if relocatable { // the linker places the segments
+		for _, name := range segNames {
+			segBase[name] = 0
+		}
+		return
+	}
+	for i := range memMap.regions {
+		memMap.regions[i].used = 0
+	}
+	for _, name := range segNames {
+		if findSegment(memMap, name) < 0 {
+			errHandler(errs["segment"], name+" is not declared in "+memMap.filename+".")
+		}
+	}
+	for i, s := range memMap.segments {
+		for _, name := range segNames {
+			if strings.EqualFold(s.name, name) {
+				var over string
+				segBase[name], over = fitSegment(&memMap, i, sizes[name], 1)
+				if over != "" {
+					overflows = append(overflows, over)
+				}
+			}
+		}
+	}
+}
+
+// Reports the regions the final layout overflows
+func checkOverflows() {
+	for _, over := range overflows {
+		errHandler(errs["overflow"], over)
+	}
+}
+
+func isBss(name string) bool {
+	n := findSegment(memMap, name)
+	return n >= 0 && memMap.segments[n].bss
+}
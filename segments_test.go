@@ -0,0 +1,135 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> segments_test.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import "testing"
+
+// Forward zero page references are sized as absolute until the passes settle, which mustn't count
+// as overflowing the region
+func TestRegionFitsOnceConverged(t *testing.T) {
+	useMemoryMap(t, `region ROM start=$c000 size=$0005
+region ZP start=$0080 size=$0080
+segment CODE region=ROM
+segment ZEROPAGE region=ZP bss
+`)
+	_, obj := testAssemble(t, `        lda ptr
+        sta ptr
+        rts
+        .segment "ZEROPAGE"
+ptr:    .res 1
+`)
+	if len(diagnostics) > 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	expectBytes(t, flatBytes(obj), "a5 80 85 80 60")
+}
+
+func TestRegionOverflow(t *testing.T) {
+	useMemoryMap(t, `region ROM start=$c000 size=$0004
+segment CODE region=ROM
+`)
+	testAssemble(t, "        lda $1234\n        sta $1234\n")
+	if !hasDiagnostic("E0029") {
+		t.Errorf("expected E0029, got %v", diagnostics)
+	}
+}
+
+// Segments go into their region in the order the map declares them, whatever order the source
+// uses them in, and a region with a fill value is padded to its full size
+func TestSegmentsPlacedInMapOrder(t *testing.T) {
+	useMemoryMap(t, `; code first, then data on a 16-byte boundary
+region RAM start=$1000 size=$0020 fill=$ff
+segment CODE region=RAM
+segment DATA region=RAM align=$10
+segment BSS region=RAM bss
+`)
+	insts, obj := testAssemble(t, `        lda msg
+        .segment "DATA"
+msg:    dfb $01,$02
+        .segment "CODE"
+        sta buf
+        rts
+        .segment "BSS"
+buf:    .res 4
+`)
+	if len(diagnostics) > 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	if segBase["CODE"] != 0x1000 || segBase["DATA"] != 0x1010 || segBase["BSS"] != 0x1012 {
+		t.Errorf("segments placed at %v", segBase)
+	}
+	image, start := flatImage(buildObject(insts, obj))
+	if start != 0x1000 {
+		t.Errorf("image starts at $%04X, want $1000", start)
+	}
+	expectBytes(t, image, "ad 10 10 8d 12 10 60 ff ff ff ff ff ff ff ff ff 01 02 ff ff ff ff ff ff ff ff ff ff ff ff ff ff")
+}
+
+// Without -map, DATA and BSS follow CODE from org and ZEROPAGE starts at $0000
+func TestDefaultMemoryMap(t *testing.T) {
+	testAssemble(t, `        org $0800
+        .segment "BSS"
+buf:    .res 2
+        .segment "ZEROPAGE"
+ptr:    .res 2
+        .segment "DATA"
+msg:    dfb $01
+        .segment "CODE"
+        lda msg
+`)
+	if len(diagnostics) > 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	want := map[string]int{"CODE": 0x0800, "DATA": 0x0803, "BSS": 0x0804, "ZEROPAGE": 0x0000}
+	for name, addr := range want {
+		if segBase[name] != addr {
+			t.Errorf("%s at $%04X, want $%04X", name, segBase[name], addr)
+		}
+	}
+}
+
+func TestMemoryMapErrors(t *testing.T) {
+	for _, test := range []struct{ cfg, src, code string }{
+		{"region RAM start=$1000 size=$0100\nsegment CODE region=ROM\n", "        nop\n", errs["memmap"][2]},
+		{"region RAM start=$f000 size=$2000\nsegment CODE region=RAM\n", "        nop\n", errs["memmap"][2]},
+		{"region RAM start=$1000 size=lots\nsegment CODE region=RAM\n", "        nop\n", errs["memmap"][2]},
+		{"area RAM start=$1000 size=$0100\n", "        nop\n", errs["memmap"][2]},
+		{"region RAM start=$1000 size=$0100\nsegment CODE region=RAM\n", "        .segment \"DATA\"\n        nop\n", errs["segment"][2]},
+		{"region RAM start=$1000 size=$0100\nsegment CODE region=RAM\n", "        org $1000\n        nop\n", errs["org"][2]},
+	} {
+		useMemoryMap(t, test.cfg)
+		testAssemble(t, test.src)
+		if !hasDiagnostic(test.code) {
+			t.Errorf("%q with %q: expected %s, got %v", test.cfg, test.src, test.code, diagnostics)
+		}
+	}
+}
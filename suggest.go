@@ -0,0 +1,176 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> suggest.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// Hints for names that aren't known: the closest known names by edit distance, so a typo such as
+// lad or lenght points at lda or length.
+
+// Returns name followed by the known names closest to it, e.g. "lad (did you mean lda?)", or
+// just name if nothing is close. known maps each name to what to suggest when it is close.
+func withHint(name string, known map[string]string) string {
+	type match struct {
+		name string
+		dist int
+	}
+	var matches []match
+	limit := 1
+	if len(name) > 4 {
+		limit = 2
+	}
+	best := map[string]int{}
+	for k, suggest := range known {
+		d := editDistance(strings.ToLower(name), strings.ToLower(k))
+		if prev, ok := best[suggest]; d <= limit && d < len(name) && (!ok || d < prev) {
+			best[suggest] = d
+		}
+	}
+	for suggest, d := range best {
+		matches = append(matches, match{suggest, d})
+	}
+	if len(matches) == 0 {
+		return name
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].dist != matches[j].dist {
+			return matches[i].dist < matches[j].dist
+		}
+		return matches[i].name < matches[j].name
+	})
+	if len(matches) > 3 {
+		matches = matches[:3]
+	}
+	hint := matches[0].name
+	for i, m := range matches[1:] {
+		if i == len(matches)-2 {
+			hint += " or " + m.name
+		} else {
+			hint += ", " + m.name
+		}
+	}
+	return name + " (did you mean " + hint + "?)"
+}
+
+// The number of single letter insertions, deletions, changes and swaps of neighbours that turn a into b
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+func minInt(first int, rest ...int) int {
+	for _, n := range rest {
+		if n < first {
+			first = n
+		}
+	}
+	return first
+}
+
+// A mnemonic or pseudo-op with the known ones closest to it
+func mnemonicHint(mnemonic string) string {
+	known := map[string]string{}
+	for name := range mnemonics {
+		known[name] = name
+	}
+	for name := range pseudoOps {
+		known[name] = name
+	}
+	return withHint(mnemonic, known)
+}
+
+// A symbol with the closest labels, constants and variables. A label in a scope is suggested by
+// its own name inside the scope, e.g. loop inside .proc print, and as print::loop elsewhere.
+func symbolHint(name string) string {
+	known := map[string]string{}
+	for _, sym := range symbols {
+		local := localName(sym.label)
+		if scope := strings.TrimSuffix(sym.label, local); strings.HasPrefix(curScope, scope) {
+			known[local] = local
+		} else {
+			known[local] = sym.label
+			known[sym.label] = sym.label
+		}
+	}
+	for name := range asmVars {
+		known[name] = name
+	}
+	return withHint(name, known)
+}
+
+// Lists the addressing modes a mnemonic has, e.g. "sty takes $44, $44,x or $4400."
+func modeHint(mnemonic string) string {
+	var modes []string
+	for _, mode := range addrModes {
+		if _, ok := mode.table[mnemonic]; !ok {
+			continue
+		}
+		switch mode.kind {
+		case "zop":
+			modes = append(modes, "no operand")
+		case "rel":
+			modes = append(modes, "a branch target")
+		default:
+			modes = append(modes, mode.example)
+		}
+	}
+	if len(modes) == 0 {
+		return ""
+	}
+	list := modes[0]
+	if n := len(modes); n > 1 {
+		list = strings.Join(modes[:n-1], ", ") + " or " + modes[n-1]
+	}
+	return mnemonic + " takes " + list + "."
+}
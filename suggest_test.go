@@ -0,0 +1,116 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> suggest_test.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	for _, test := range []struct {
+		a, b string
+		want int
+	}{
+		{"lda", "lda", 0},
+		{"lad", "lda", 1},
+		{"ld", "lda", 1},
+		{"ldaa", "lda", 1},
+		{"ldx", "lda", 1},
+		{"lenght", "length", 1},
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+	} {
+		if got := editDistance(test.a, test.b); got != test.want {
+			t.Errorf("%s to %s: got %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+// The closest names come first, then alphabetically, and at most three are suggested
+func TestHintRanking(t *testing.T) {
+	known := map[string]string{}
+	for _, name := range []string{"count", "counts", "mount", "cout", "amount", "xyzzy", "court"} {
+		known[name] = name
+	}
+	for _, test := range []struct{ name, want string }{
+		{"coutn", "coutn (did you mean count, cout or counts?)"},
+		{"counts", "counts (did you mean counts, count or court?)"},
+		{"xyzzy", "xyzzy (did you mean xyzzy?)"},
+		{"zzz", "zzz"},
+		{"ab", "ab"},
+	} {
+		if got := withHint(test.name, known); got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+		}
+	}
+	// short names only get suggestions one edit away
+	if got := withHint("cnt", map[string]string{"count": "count"}); got != "cnt" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestMnemonicAndModeHints(t *testing.T) {
+	if got := mnemonicHint("lad"); !strings.HasPrefix(got, "lad (did you mean lda") {
+		t.Errorf("got %q", got)
+	}
+	if got := mnemonicHint(".endprco"); got != ".endprco (did you mean .endproc?)" {
+		t.Errorf("got %q", got)
+	}
+	if got := modeHint("sty"); got != "sty takes $44, $44,x or $4400." {
+		t.Errorf("got %q", got)
+	}
+	if got := modeHint("bne"); got != "bne takes a branch target." {
+		t.Errorf("got %q", got)
+	}
+	if got := modeHint("nop"); got != "nop takes no operand." {
+		t.Errorf("got %q", got)
+	}
+}
+
+// Labels in a scope are suggested by their own name inside it and by their full name outside
+func TestSymbolHints(t *testing.T) {
+	testAssemble(t, `        .proc print
+lenght: rts
+        jmp lengt
+        .endproc
+        jmp lengt
+`)
+	var got []string
+	for _, d := range diagnostics {
+		got = append(got, d.message)
+	}
+	want := []string{errs["unknownsym"][1] + " lengt (did you mean lenght?)", errs["unknownsym"][1] + " lengt (did you mean print::lenght?)"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
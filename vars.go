@@ -0,0 +1,142 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> vars.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Assembly-time variables: names given a value with "name = expr" or "name .set expr" that can be
+// set again further on, and the variables of .rept and .for. Merlin-style names starting with ]
+// are always variables. A line sees the value last set above it in the same pass; each pass starts
+// with none set, so every pass agrees.
+
+var asmVars = map[string]int{}  // variables as of the line being assembled
+var lineVars []map[string]int   // variables as of each instruction in the last pass
+var varLines = map[string]int{} // instruction first setting each variable
+
+// Forgets the variables at the start of each pass
+func resetVars() {
+	asmVars = map[string]int{}
+	lineVars = nil
+	varLines = map[string]int{}
+}
+
+// The value of a variable at the line being assembled
+func varValue(name string) (int, bool) {
+	val, ok := asmVars[name]
+	return val, ok
+}
+
+func isVariable(name string) bool {
+	_, ok := asmVars[name]
+	return ok
+}
+
+// Sets a variable. The map is copied rather than changed, since the lines above keep the one they
+// saw.
+func setVar(name string, val int) {
+	vars := make(map[string]int, len(asmVars)+1)
+	for k, v := range asmVars {
+		vars[k] = v
+	}
+	vars[name] = val
+	asmVars = vars
+}
+
+func unsetVar(name string) {
+	vars := make(map[string]int, len(asmVars))
+	for k, v := range asmVars {
+		if k != name {
+			vars[k] = v
+		}
+	}
+	asmVars = vars
+}
+
+// Handles "name = expr" and "name .set expr". Symbols that aren't defined yet count as 0 until a
+// later pass.
+func parseSet(name string, expr string) {
+	if name == "" || expr == "" {
+		errHandler(errs["variable"], "Expected a name and a value, e.g. count = 0.")
+		return
+	}
+	if _, ok := lookupScoped(name); ok {
+		errHandler(errs["variable"], name+" is a label or constant, so it can't be set.")
+		return
+	}
+	pc := -1
+	if pass > 1 && curLine < len(passAddrs) {
+		pc = passAddrs[curLine]
+	}
+	val, refs, unknown, e := evalOperand(expr, pc)
+	if e != nil {
+		errHandler(errs["expression"], e.Error())
+		return
+	}
+	if len(unknown) > 0 && pass > 1 {
+		errHandler(errs["unknownsym"], symbolHint(unknown[0]))
+	}
+	for _, ref := range refs {
+		addReference(ref, "")
+	}
+	if _, ok := varLines[name]; !ok {
+		varLines[name] = curLine
+	}
+	setVar(name, val)
+}
+
+// Adds the variables and the last value each was set to after the symbol table
+func logVariables() {
+	var names, values []string
+	for name := range varLines {
+		if isVariable(name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values = append(values, fmt.Sprintf("$%04X", asmVars[name]&0xffff))
+	}
+	log += "\n\nVariables (last value set)\n"
+	logColumns(names, values, "")
+}
+
+// Whether a label is a Merlin-style variable name such as ]count
+func isVarName(label string) bool {
+	return strings.HasPrefix(label, "]")
+}
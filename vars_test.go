@@ -0,0 +1,81 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> vars_test.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Each line sees the value set last above it, in every pass and in every copy of a loop
+func TestVariables(t *testing.T) {
+	_, obj := testAssemble(t, `        org $0800
+count   = 0
+        .rept 3
+count   = count+1
+        dfb count
+        .endrept
+]ptr    = $80
+        sta ]ptr
+]ptr    = ]ptr+2
+        sta ]ptr
+        .assert ]ptr == $82
+step    .set end-*
+        dfb step
+end:    rts
+`)
+	if len(diagnostics) > 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	expectBytes(t, flatBytes(obj), "01 02 03 85 80 85 82 01 60")
+	log = ""
+	logVariables()
+	if !strings.Contains(log, "]ptr") || !strings.Contains(log, "$0082") || !strings.Contains(log, "count") {
+		t.Errorf("variables listed as %q", log)
+	}
+}
+
+func TestVariableErrors(t *testing.T) {
+	for _, test := range []struct{ src, err string }{
+		{"        dfb count\ncount   = 1\n", "unknownsym"},
+		{"start:  nop\nstart   = 2\n", "duplicatesym"},
+		{"size    equ $10\nsize    .set 2\n", "variable"},
+		{"count   = 1\ncount:  nop\n", "duplicatesym"},
+		{"count   =\n", "variable"},
+		{"count   = 1+\n", "expression"},
+	} {
+		testAssemble(t, test.src)
+		if !hasDiagnostic(errs[test.err][2]) {
+			t.Errorf("%q: got %v, want %s", test.src, diagnostics, errs[test.err][2])
+		}
+	}
+}
@@ -0,0 +1,192 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> watch.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+var watchMode bool = false
+
+const watchInterval = 500 * time.Millisecond
+const watchDiffLines int = 20 // changed ranges shown before the rest are summarized
+
+// Reassembles whenever the source or memory map changes, reporting which bytes changed since the
+// last successful build. Runs until interrupted.
+func watchSource() {
+	continueOnError = true
+	files := []string{filename}
+	if mapFilename != "" {
+		files = append(files, mapFilename)
+	}
+	var previous map[int]byte
+	var stamps []time.Time
+	for {
+		current := fileStamps(files)
+		if !sameStamps(current, stamps) {
+			stamps = current
+			fmt.Println("\n" + time.Now().Format("15:04:05") + " assembling " + filename)
+			image, summary, ok := watchBuild()
+			if ok {
+				if previous != nil {
+					fmt.Print(imageDiff(previous, image))
+				}
+				fmt.Println(summary)
+				previous = image
+			} else {
+				fmt.Println("Build failed; waiting for changes.")
+			}
+		}
+		time.Sleep(watchInterval)
+	}
+}
+
+// Runs one build, surviving anything the parser can't, and returns the bytes written by address
+func watchBuild() (image map[int]byte, summary string, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Println("Assembly stopped:", r)
+			ok = false
+		}
+	}()
+	insts, obj := build()
+	if errorCount > 0 {
+		return nil, "", false
+	}
+	return buildImage(insts, obj), fillSummary(insts, obj), true
+}
+
+// The bytes of a build by imageKey
+func buildImage(insts []instruction, obj [][]byte) map[int]byte {
+	image := map[int]byte{}
+	segs := lineSegments(insts)
+	for i, line := range obj {
+		for j, b := range line {
+			image[imageKey(segmentBank(segs[i]), lineAddrs[i]+j)] = b
+		}
+	}
+	return image
+}
+
+// Keys bytes by bank as well as address, so banks that share addresses stay apart. Bytes outside
+// the banks keep their address.
+func imageKey(bank int, addr int) int {
+	return (bank+1)<<16 | addr
+}
+
+// Shows an image key as an address, with the bank first if it has one, e.g. $01:8000
+func imageAddr(key int) string {
+	if bank := key>>16 - 1; bank >= 0 {
+		return fmt.Sprintf("$%02X:%04X", bank, key&0xffff)
+	}
+	return fmt.Sprintf("$%04X", key)
+}
+
+func fileStamps(files []string) (stamps []time.Time) {
+	for _, f := range files {
+		var t time.Time
+		if st, e := os.Stat(f); e == nil {
+			t = st.ModTime()
+		}
+		stamps = append(stamps, t)
+	}
+	return
+}
+
+func sameStamps(a []time.Time, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Lists runs of addresses whose bytes changed, appeared or disappeared between two builds. The
+// images are keyed by imageKey.
+func imageDiff(before map[int]byte, after map[int]byte) (out string) {
+	var addrs []int
+	for a := range before {
+		addrs = append(addrs, a)
+	}
+	for a := range after {
+		if _, ok := before[a]; !ok {
+			addrs = append(addrs, a)
+		}
+	}
+	sort.Ints(addrs)
+	changed := func(a int) bool {
+		b1, ok1 := before[a]
+		b2, ok2 := after[a]
+		return ok1 != ok2 || b1 != b2
+	}
+	bytesAt := func(image map[int]byte, from int, to int) (str string) {
+		for a := from; a <= to && a < from+8; a++ {
+			if b, ok := image[a]; ok {
+				str += fmt.Sprintf("%02X ", b)
+			} else {
+				str += "-- "
+			}
+		}
+		if to-from >= 8 {
+			str += "... "
+		}
+		return
+	}
+	var runs int = 0
+	for i := 0; i < len(addrs); i++ {
+		if !changed(addrs[i]) {
+			continue
+		}
+		j := i
+		for j+1 < len(addrs) && addrs[j+1] == addrs[j]+1 && addrs[j+1]&0xffff != 0 && changed(addrs[j+1]) {
+			j++
+		}
+		if runs < watchDiffLines {
+			out += fmt.Sprintf("  %s-%s  %s-> %s\n", imageAddr(addrs[i]), imageAddr(addrs[j]), bytesAt(before, addrs[i], addrs[j]), bytesAt(after, addrs[i], addrs[j]))
+		}
+		runs++
+		i = j
+	}
+	if runs == 0 {
+		out += "  No bytes changed.\n"
+	} else if runs > watchDiffLines {
+		out += fmt.Sprintf("  ... and %d more changed ranges\n", runs-watchDiffLines)
+	}
+	return
+}
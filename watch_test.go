@@ -0,0 +1,152 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> watch_test.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Banks that share addresses are compared bank by bank
+func TestImageDiffKeepsBanksApart(t *testing.T) {
+	useMemoryMap(t, `region B0 start=$8000 size=$0008 bank=0
+region B1 start=$8000 size=$0008 bank=1
+segment BANK0 region=B0
+segment BANK1 region=B1
+`)
+	build := func(b1 string) map[int]byte {
+		insts, obj := testAssemble(t, "        .segment \"BANK0\"\n        dfb $01,$02\n        .segment \"BANK1\"\n        dfb "+b1+"\n")
+		if len(diagnostics) > 0 {
+			t.Fatalf("unexpected diagnostics %v", diagnostics)
+		}
+		return buildImage(insts, obj)
+	}
+	before, after := build("$03,$04"), build("$03,$05")
+	if len(before) != 4 {
+		t.Errorf("got %d bytes in the image, want 4", len(before))
+	}
+	want := "  $01:8001-$01:8001  04 -> 05 \n"
+	if got := imageDiff(before, after); got != want {
+		t.Errorf("got diff %q, want %q", got, want)
+	}
+}
+
+func TestImageDiffRuns(t *testing.T) {
+	before := map[int]byte{0x5000: 1, 0x5001: 2, 0x5002: 3}
+	after := map[int]byte{0x5000: 1, 0x5001: 9, 0x5002: 9, 0x5003: 4}
+	got := imageDiff(before, after)
+	if !strings.Contains(got, "$5001-$5003  02 03 -- -> 09 09 04") {
+		t.Errorf("got diff %q", got)
+	}
+	if got := imageDiff(before, before); got != "  No bytes changed.\n" {
+		t.Errorf("got diff %q for the same image", got)
+	}
+}
+
+// Long runs show their first bytes, and only the first watchDiffLines runs are listed
+func TestImageDiffSummarizes(t *testing.T) {
+	before, after := map[int]byte{}, map[int]byte{}
+	for a := 0; a < 12; a++ {
+		before[0x1000+a], after[0x1000+a] = 0, 1
+	}
+	for n := 0; n < watchDiffLines+3; n++ {
+		before[0x2000+n*2] = 0
+	}
+	got := strings.Split(imageDiff(before, after), "\n")
+	if want := "  $1000-$100B  00 00 00 00 00 00 00 00 ... -> 01 01 01 01 01 01 01 01 ... "; got[0] != want {
+		t.Errorf("got %q, want %q", got[0], want)
+	}
+	if want := "  ... and 4 more changed ranges"; got[watchDiffLines] != want {
+		t.Errorf("got %q, want %q", got[watchDiffLines], want)
+	}
+}
+
+// Each build the watcher runs reports whether it succeeded and the bytes it made
+func TestWatchBuild(t *testing.T) {
+	quiet(t)
+	dir := t.TempDir()
+	saved := []string{filename, ofilename, logfilename}
+	filename, ofilename, logfilename = filepath.Join(dir, "test.s"), filepath.Join(dir, "test.o"), filepath.Join(dir, "test.log")
+	continueOnError = true
+	defer func() {
+		filename, ofilename, logfilename = saved[0], saved[1], saved[2]
+		continueOnError = false
+	}()
+	write := func(src string) {
+		if err := ioutil.WriteFile(filename, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("        org $0800\n        lda #$01\n")
+	before, summary, ok := watchBuild()
+	if !ok || !strings.Contains(summary, "$0800 through $0801") {
+		t.Fatalf("first build: ok %v, summary %q", ok, summary)
+	}
+	write("        org $0800\n        lda #$02\n")
+	after, _, ok := watchBuild()
+	if got := imageDiff(before, after); !ok || got != "  $0801-$0801  01 -> 02 \n" {
+		t.Errorf("second build: ok %v, diff %q", ok, got)
+	}
+	write("        org $0800\n        lad #$02\n")
+	if _, _, ok := watchBuild(); ok {
+		t.Error("build with an error succeeded")
+	}
+}
+
+func TestFileStamps(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.s")
+	missing := fileStamps([]string{file})
+	if !missing[0].IsZero() {
+		t.Errorf("missing file stamped %v", missing[0])
+	}
+	if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	first := fileStamps([]string{file})
+	if sameStamps(missing, first) || !sameStamps(first, fileStamps([]string{file})) {
+		t.Error("creating the file not told apart from leaving it")
+	}
+	later := first[0].Add(time.Second)
+	if err := os.Chtimes(file, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if sameStamps(first, fileStamps([]string{file})) {
+		t.Error("change to the file not noticed")
+	}
+	if sameStamps(first, nil) {
+		t.Error("no stamps taken as the same")
+	}
+}
@@ -0,0 +1,126 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> xref.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type xref struct {
+	label string
+	line  int    // line of the referencing instruction
+	kind  string // see refKinds
+}
+
+var refKinds = map[string]string{
+	"B": "branch",
+	"D": "data",
+	"J": "jump",
+	"M": "read-modify-write",
+	"R": "read",
+	"W": "write"}
+
+// Records a reference to a known symbol from the current line during the final pass
+func addReference(label string, mnemonic string) {
+	if pass < 2 || !symbolExists(label) {
+		return
+	}
+	references = append(references, xref{label, curLine, refKind(mnemonic)})
+}
+
+// Classifies how an instruction uses its operand
+func refKind(mnemonic string) string {
+	if _, ok := opRel[mnemonic]; ok {
+		return "B"
+	}
+	switch mnemonic {
+	case "jmp", "jsr":
+		return "J"
+	case "sta", "stx", "sty":
+		return "W"
+	case "inc", "dec", "lsr", "rol", "ror":
+		return "M"
+	}
+	if isData(mnemonic) {
+		return "D"
+	}
+	return "R"
+}
+
+// Builds the cross-reference report: each symbol with its value, defining line and every referencing line
+func crossReference() (out string) {
+	if len(symbols) == 0 {
+		return
+	}
+	out += setStringToWidth("\n\nCross Reference ", 75, "=") + "\n"
+	var keys []string
+	for kind, desc := range refKinds {
+		keys = append(keys, kind+"="+desc)
+	}
+	sort.Strings(keys)
+	out += "Lines are suffixed " + strings.Join(keys, ", ") + "\n\n"
+	sorted := make([]symbol, len(symbols))
+	copy(sorted, symbols)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].label < sorted[j].label })
+	width := 8 // wider for names qualified with their scope
+	for _, sym := range sorted {
+		if len(sym.label) >= width {
+			width = len(sym.label) + 1
+		}
+	}
+	for _, sym := range sorted {
+		row := setStringToWidth(sym.label, width)
+		row += setStringToWidth(fmt.Sprintf("$%04X", sym.intAddr), 7)
+		row += setStringToWidth("def "+strconv.Itoa(sourceLine(sym.defLine)+1), 10)
+		var count int
+		for _, ref := range references {
+			if ref.label != sym.label {
+				continue
+			}
+			item := strconv.Itoa(sourceLine(ref.line)+1) + ref.kind + " "
+			if len(row)+len(item) > 75 {
+				out += strings.TrimRight(row, " ") + "\n"
+				row = strings.Repeat(" ", width+17)
+			}
+			row += item
+			count++
+		}
+		if count == 0 {
+			row += "(unreferenced)"
+		}
+		out += strings.TrimRight(row, " ") + "\n"
+	}
+	return
+}
@@ -0,0 +1,96 @@
+/* 	Hobbyist's Assembler for 6502 microprocessors
+	A simple assembler for little projects and tinkering
+	See README.md for more information
+
+	-> xref_test.go
+
+=============================================================================
+MIT License
+
+Copyright (c) 2020 Dr. Christopher Graham
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+==============================================================================
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Each use of a symbol is listed with its line and how the line uses it
+func TestXrefKinds(t *testing.T) {
+	testAssemble(t, `        org $0800
+count   equ $10
+start:  lda count
+        sta count
+        inc count
+        rol count
+        bne start
+        jsr sub
+        jmp start
+sub:    rts
+table:  dfb <start,>start
+        .word sub
+spare:  nop
+`)
+	want := []string{
+		"count   $0010  def 2     3R 4W 5M 6M",
+		"spare   $0815  def 13    (unreferenced)",
+		"start   $0800  def 3     7B 9J 11D 11D",
+		"sub     $0810  def 10    8J 12D",
+		"table   $0811  def 11    (unreferenced)"}
+	rows := strings.Split(crossReference(), "\n")
+	if got := strings.Join(rows[5:len(rows)-1], "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("cross reference\n%s\nwant\n%s", got, strings.Join(want, "\n"))
+	}
+}
+
+// Symbols in expressions and in directives such as .assert count as reads
+func TestXrefExpressions(t *testing.T) {
+	testAssemble(t, `        org $0800
+base    equ $20
+top     equ base+2
+        lda top+1,x
+        .assert top > base
+`)
+	want := []string{
+		"base    $0020  def 2     3R 5R",
+		"top     $0022  def 3     4R 5R"}
+	rows := strings.Split(crossReference(), "\n")
+	if got := strings.Join(rows[5:len(rows)-1], "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("cross reference\n%s\nwant\n%s", got, strings.Join(want, "\n"))
+	}
+}
+
+// References wrap onto indented rows rather than running past the report's width
+func TestXrefWraps(t *testing.T) {
+	src := "        org $0800\nstart:  nop\n" + strings.Repeat("        jmp start\n", 20)
+	testAssemble(t, src)
+	for _, row := range strings.Split(crossReference(), "\n")[5:] {
+		if len(row) > 75 {
+			t.Errorf("row of %d characters: %s", len(row), row)
+		}
+	}
+	if !strings.Contains(crossReference(), "\n"+strings.Repeat(" ", 25)+"1") {
+		t.Error("references didn't continue on an indented row")
+	}
+}